@@ -5,93 +5,79 @@ import (
 	"log"
 	"os"
 	"strings"
+
+	"github.com/codecrafters-io/sqlite-starter-go/sqlitego"
 )
 
 func main() {
 	databaseFilePath := os.Args[1]
 	command := os.Args[2]
 	lower := strings.ToLower(command)
+
+	db, err := sqlitego.Open(databaseFilePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
 	switch {
 	case lower == ".dbinfo":
-		pageSize, numberOfTables, err := dbInfo(databaseFilePath)
-		if err != nil {
-			log.Fatal(err)
+		for _, line := range db.Info().Lines() {
+			fmt.Println(line)
 		}
-		fmt.Println("database page size: ", pageSize)
-		fmt.Println("number of tables: ", numberOfTables)
 
 	case lower == ".tables":
-		names, err := tableNames(databaseFilePath)
-		if err != nil {
-			log.Fatal(err)
-			return
-		}
-		fmt.Println(names)
-	case strings.HasPrefix(lower, "select count(*) from "):
-		parts := strings.Fields(command)
-		if len(parts) != 4 {
-			log.Fatal("Invalid COUNT query format")
-		}
-		tableName := parts[len(parts)-1]
-		cnt, err := countRows(databaseFilePath, tableName)
+		printColumns(db.TableNames())
+	case strings.HasPrefix(lower, "."):
+		fmt.Println("Unknown command", command)
+		db.Close()
+		os.Exit(1)
+	default:
+		rows, err := db.Query(command)
 		if err != nil {
+			db.Close()
 			log.Fatal(err)
-			return
 		}
-
-		fmt.Println(cnt)
-
-	case strings.HasPrefix(lower, "select"):
-		parts := strings.Fields(command)
-		if len(parts) < 4 {
-			log.Fatal("Invalid select query format")
-		}
-		// Tìm vị trí "from"
-		fromIdx := -1
-		for i, p := range parts {
-			if strings.ToLower(p) == "from" {
-				fromIdx = i
-				break
+		defer rows.Close()
+		for rows.Next() {
+			values := make([]string, len(rows.Values()))
+			for i, v := range rows.Values() {
+				values[i] = v.String()
+				// Like sqlite3, print TEXT and BLOB values up to their first NUL.
+				if end := strings.IndexByte(values[i], 0); end >= 0 {
+					values[i] = values[i][:end]
+				}
 			}
+			fmt.Println(strings.Join(values, "|"))
 		}
-		if fromIdx == -1 || fromIdx < 2 {
-			log.Fatal("Invalid select query format")
-		}
-		tableName := parts[fromIdx+1]
-		// Ghép lại các cột từ sau SELECT đến trước FROM
-		colStr := strings.Join(parts[1:fromIdx], " ")
-		cols := strings.Split(colStr, ",")
-		for i := range cols {
-			cols[i] = strings.TrimSpace(cols[i])
+		if err := rows.Err(); err != nil {
+			// log.Fatal skips deferred calls, and closing rows removes the
+			// temporary files of a sort.
+			rows.Close()
+			db.Close()
+			log.Fatal(err)
 		}
+	}
+}
 
-		// Parse WHERE nếu có
-		whereCol := ""
-		whereVal := ""
-		for i, p := range parts {
-			if strings.ToLower(p) == "where" && i+3 <= len(parts) {
-				whereCol = parts[i+1]
-				whereVal = strings.Join(parts[i+3:], " ")
-				whereVal = strings.Trim(whereVal, "'")
-				break
+// printColumns prints names the way sqlite3 does: in as many columns as fit in
+// 80 characters, filled top to bottom, each padded to the longest name.
+func printColumns(names []string) {
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	columns := max(80/(width+2), 1)
+	rows := (len(names) + columns - 1) / columns
+	for i := 0; i < rows; i++ {
+		var line strings.Builder
+		for j := i; j < len(names); j += rows {
+			if j >= rows {
+				line.WriteString("  ")
 			}
+			// Widths count bytes, as in sqlite3.
+			line.WriteString(names[j] + strings.Repeat(" ", width-len(names[j])))
 		}
-		var data []string
-		var err error
-		if whereCol != "" {
-			data, err = readDataFromSelect(databaseFilePath, tableName, cols, whereCol, whereVal)
-		} else {
-			data, err = readDataFromSelect(databaseFilePath, tableName, cols, "", "")
-		}
-		if err != nil {
-			log.Fatal(err)
-			return
-		}
-		for _, value := range data {
-			fmt.Println(value)
-		}
-	default:
-		fmt.Println("Unknown command", command)
-		os.Exit(1)
+		fmt.Println(line.String())
 	}
 }
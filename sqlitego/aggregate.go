@@ -0,0 +1,467 @@
+package sqlitego
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// accumulator folds the arguments of one aggregate call over the rows of a
+// group.
+type accumulator interface {
+	step(args []Value) error
+	result() (Value, error)
+}
+
+// aggregateFunc describes a built-in aggregate function.
+type aggregateFunc struct {
+	minArgs, maxArgs int
+	new              func() accumulator
+}
+
+var aggregateFuncs = map[string]aggregateFunc{
+	"count":        {0, 1, func() accumulator { return &countAcc{} }},
+	"sum":          {1, 1, func() accumulator { return &sumAcc{kind: "sum"} }},
+	"total":        {1, 1, func() accumulator { return &sumAcc{kind: "total"} }},
+	"avg":          {1, 1, func() accumulator { return &sumAcc{kind: "avg"} }},
+	"min":          {1, 1, func() accumulator { return &minMaxAcc{} }},
+	"max":          {1, 1, func() accumulator { return &minMaxAcc{max: true} }},
+	"group_concat": {1, 2, func() accumulator { return &concatAcc{} }},
+	"string_agg":   {2, 2, func() accumulator { return &concatAcc{} }},
+}
+
+// aggregateCall is one aggregate function call of a query. Its result is
+// stored in the aggregated row at column slot.
+type aggregateCall struct {
+	name     string
+	fn       aggregateFunc
+	args     []*compiledExpr
+	distinct bool
+	slot     int
+}
+
+func (c *aggregateCall) newAccumulator() accumulator {
+	acc := c.fn.new()
+	if mm, ok := acc.(*minMaxAcc); ok {
+		mm.collation = c.args[0].collation
+	}
+	if c.distinct {
+		return &distinctAcc{inner: acc, seen: newRowSet([]Collation{c.args[0].collation})}
+	}
+	return acc
+}
+
+// aggregateContext collects the aggregate calls met while compiling the SELECT
+// list and HAVING clause. The aggregated rows they are evaluated against hold
+// the columns of the input scope followed by one column per call.
+type aggregateContext struct {
+	input *scope
+	calls []*aggregateCall
+}
+
+func (a *aggregateContext) add(e *FuncCall, fn aggregateFunc) (*compiledExpr, error) {
+	name := strings.ToLower(e.Name)
+	if e.Star && name != "count" || len(e.Args) < fn.minArgs || len(e.Args) > fn.maxArgs {
+		return nil, fmt.Errorf("wrong number of arguments to function %s()", e.Name)
+	}
+	if e.Distinct && len(e.Args) != 1 {
+		return nil, fmt.Errorf("DISTINCT aggregates must have exactly one argument")
+	}
+	call := &aggregateCall{name: name, fn: fn, distinct: e.Distinct, slot: len(a.input.columns) + len(a.calls)}
+	for _, arg := range e.Args {
+		compiled, err := compileExpr(arg, a.input)
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, compiled)
+	}
+	a.calls = append(a.calls, call)
+	slot := call.slot
+	return &compiledExpr{eval: func(row Row) (Value, error) { return row[slot], nil }}, nil
+}
+
+// extremumCall returns the index of the query's only min() or max() call, or -1.
+// SQLite takes the bare columns of such a query from the row holding the
+// minimum or maximum.
+func (a *aggregateContext) extremumCall() int {
+	found := -1
+	for i, call := range a.calls {
+		if call.name == "min" || call.name == "max" {
+			if found >= 0 {
+				return -1
+			}
+			found = i
+		}
+	}
+	return found
+}
+
+// aggregate folds runs of rows with equal GROUP BY keys into one row each. Its
+// source must deliver the rows of a group next to each other. Without GROUP BY
+// the whole input is one group, which yields a row even when it is empty.
+// Columns outside aggregate calls read the first row of the group, or the row
+// holding the minimum or maximum (see extremumCall).
+type aggregate struct {
+	src      rowSource
+	groupBy  []*compiledExpr
+	ctx      *aggregateContext
+	extremum int // see extremumCall
+
+	started bool
+	pending Row // first row of the next group, already read from src
+	keys    []Value
+	done    bool
+	row     Row
+}
+
+func newAggregate(src rowSource, groupBy []*compiledExpr, ctx *aggregateContext) *aggregate {
+	return &aggregate{src: src, groupBy: groupBy, ctx: ctx, extremum: ctx.extremumCall()}
+}
+
+func (a *aggregate) Next() (bool, error) {
+	if a.done {
+		return false, nil
+	}
+	if !a.started {
+		a.started = true
+		if err := a.advance(); err != nil {
+			return false, err
+		}
+		if a.pending == nil && len(a.groupBy) > 0 {
+			a.done = true
+			return false, nil
+		}
+	}
+	if a.pending == nil && a.row != nil {
+		a.done = true
+		return false, nil
+	}
+
+	accs := make([]accumulator, len(a.ctx.calls))
+	for i, call := range a.ctx.calls {
+		accs[i] = call.newAccumulator()
+	}
+	bare := a.pending
+	keys := a.keys
+	for a.pending != nil {
+		if !sameKeys(keys, a.keys, a.groupBy) {
+			break
+		}
+		in := a.pending
+		for i, call := range a.ctx.calls {
+			args := make([]Value, len(call.args))
+			for j, arg := range call.args {
+				v, err := arg.eval(in)
+				if err != nil {
+					return false, err
+				}
+				args[j] = v
+			}
+			if err := accs[i].step(args); err != nil {
+				return false, err
+			}
+		}
+		if a.extremum >= 0 && extremumUpdated(accs[a.extremum]) {
+			bare = in
+		}
+		if err := a.advance(); err != nil {
+			return false, err
+		}
+	}
+
+	width := len(a.ctx.input.columns)
+	a.row = make(Row, width+len(accs))
+	copy(a.row, bare) // a nil bare leaves the columns of an empty input NULL
+	for i, acc := range accs {
+		v, err := acc.result()
+		if err != nil {
+			return false, err
+		}
+		a.row[width+i] = v
+	}
+	return true, nil
+}
+
+// advance reads the next input row into pending and evaluates its group keys.
+func (a *aggregate) advance() error {
+	ok, err := a.src.Next()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		a.pending = nil
+		return nil
+	}
+	a.pending = a.src.Row()
+	a.keys = make([]Value, len(a.groupBy))
+	for i, key := range a.groupBy {
+		if a.keys[i], err = key.eval(a.pending); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *aggregate) Row() Row {
+	return a.row
+}
+
+func (a *aggregate) Close() error {
+	return a.src.Close()
+}
+
+// sameKeys reports whether two rows belong to the same group. NULLs group
+// together.
+func sameKeys(a, b []Value, groupBy []*compiledExpr) bool {
+	for i, key := range groupBy {
+		if CompareValues(a[i], b[i], key.collation) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+type countAcc struct {
+	n int64
+}
+
+func (c *countAcc) step(args []Value) error {
+	if len(args) == 0 || !args[0].IsNull() {
+		c.n++
+	}
+	return nil
+}
+
+func (c *countAcc) result() (Value, error) {
+	return IntegerValue(c.n), nil
+}
+
+// sumAcc implements sum(), total() and avg() like SQLite: integers are summed
+// exactly until a REAL shows up or the sum overflows, after which the sum is
+// kept as a REAL with Kahan-Babuska-Neumaier error compensation.
+type sumAcc struct {
+	kind     string
+	count    int64
+	intSum   int64
+	approx   bool
+	overflow bool
+	sum, err float64
+}
+
+func (s *sumAcc) step(args []Value) error {
+	v := numericType(args[0])
+	switch {
+	case v.IsNull():
+		return nil
+	case !s.approx && v.Type == TypeInteger:
+		if sum, ok := addInt64(s.intSum, v.Int); ok {
+			s.intSum = sum
+			break
+		}
+		s.overflow = true
+		s.startApprox()
+		s.addInt(v.Int)
+	case !s.approx:
+		s.startApprox()
+		s.add(realOf(v))
+	case v.Type == TypeInteger:
+		s.addInt(v.Int)
+	default:
+		s.overflow = false
+		s.add(realOf(v))
+	}
+	s.count++
+	return nil
+}
+
+func (s *sumAcc) startApprox() {
+	s.approx = true
+	s.sum, s.err = splitInt(s.intSum)
+}
+
+func (s *sumAcc) add(r float64) {
+	t := s.sum + r
+	if math.Abs(s.sum) > math.Abs(r) {
+		s.err += (s.sum - t) + r
+	} else {
+		s.err += (r - t) + s.sum
+	}
+	s.sum = t
+}
+
+// addInt adds an integer too large for a float64 in two parts, so that no bits
+// are lost before the error term can pick them up.
+func (s *sumAcc) addInt(i int64) {
+	big, small := splitInt(i)
+	s.add(big)
+	if small != 0 {
+		s.add(small)
+	}
+}
+
+func splitInt(i int64) (float64, float64) {
+	if i > -1<<52 && i < 1<<52 {
+		return float64(i), 0
+	}
+	small := i % 16384
+	return float64(i - small), float64(small)
+}
+
+func (s *sumAcc) total() float64 {
+	if !s.approx {
+		return float64(s.intSum)
+	}
+	if math.IsInf(s.err, 0) || math.IsNaN(s.err) {
+		return s.sum
+	}
+	return s.sum + s.err
+}
+
+func (s *sumAcc) result() (Value, error) {
+	switch s.kind {
+	case "total":
+		return RealValue(s.total()), nil
+	case "avg":
+		if s.count == 0 {
+			return NullValue(), nil
+		}
+		return RealValue(s.total() / float64(s.count)), nil
+	}
+	switch {
+	case s.count == 0:
+		return NullValue(), nil
+	case s.overflow:
+		return Value{}, fmt.Errorf("integer overflow")
+	case s.approx:
+		return RealValue(s.total()), nil
+	}
+	return IntegerValue(s.intSum), nil
+}
+
+func addInt64(a, b int64) (int64, bool) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, false
+	}
+	return sum, true
+}
+
+// numericType converts TEXT that looks like a number to that number, the way
+// sqlite3_value_numeric_type does; other values are returned unchanged.
+func numericType(v Value) Value {
+	if v.Type != TypeText {
+		return v
+	}
+	n, ok := parseNumericText(string(v.Bytes))
+	if !ok {
+		return v
+	}
+	if n.Type == TypeInteger && strings.ContainsAny(string(v.Bytes), ".eE") {
+		return RealValue(n.float())
+	}
+	return n
+}
+
+// realOf converts a value to REAL, reading TEXT and BLOB by their numeric prefix.
+func realOf(v Value) float64 {
+	switch v.Type {
+	case TypeInteger, TypeReal:
+		return v.float()
+	case TypeText, TypeBlob:
+		return numericPrefix(string(v.Bytes)).float()
+	}
+	return 0
+}
+
+// minMaxAcc keeps the first of the smallest (or largest) non-NULL values.
+type minMaxAcc struct {
+	max       bool
+	collation Collation
+	best      Value
+	seen      bool
+	changed   bool
+}
+
+func (m *minMaxAcc) step(args []Value) error {
+	v := args[0]
+	m.changed = false
+	if v.IsNull() {
+		return nil
+	}
+	if m.seen {
+		c := CompareValues(v, m.best, m.collation)
+		if m.max && c <= 0 || !m.max && c >= 0 {
+			return nil
+		}
+	}
+	m.best, m.seen, m.changed = v, true, true
+	return nil
+}
+
+// extremumUpdated reports whether the last step of a min() or max()
+// accumulator replaced the value it keeps.
+func extremumUpdated(acc accumulator) bool {
+	switch acc := acc.(type) {
+	case *minMaxAcc:
+		return acc.changed
+	case *distinctAcc:
+		return acc.passed && extremumUpdated(acc.inner)
+	}
+	return false
+}
+
+func (m *minMaxAcc) result() (Value, error) {
+	if !m.seen {
+		return NullValue(), nil
+	}
+	return m.best, nil
+}
+
+// concatAcc implements group_concat(x [, sep]): every non-NULL x after the first
+// is preceded by the separator given with it, "," by default.
+type concatAcc struct {
+	buf  []byte
+	seen bool
+}
+
+func (c *concatAcc) step(args []Value) error {
+	if args[0].IsNull() {
+		return nil
+	}
+	if c.seen {
+		if len(args) > 1 {
+			c.buf = append(c.buf, args[1].String()...)
+		} else {
+			c.buf = append(c.buf, ',')
+		}
+	}
+	c.seen = true
+	c.buf = append(c.buf, args[0].String()...)
+	return nil
+}
+
+func (c *concatAcc) result() (Value, error) {
+	if !c.seen {
+		return NullValue(), nil
+	}
+	return TextValue(string(c.buf)), nil
+}
+
+// distinctAcc passes each distinct non-NULL value to inner once.
+type distinctAcc struct {
+	inner  accumulator
+	seen   *rowSet
+	passed bool // whether the last value reached inner
+}
+
+func (d *distinctAcc) step(args []Value) error {
+	d.passed = !args[0].IsNull() && d.seen.add(Row{args[0]})
+	if !d.passed {
+		return nil
+	}
+	return d.inner.step(args)
+}
+
+func (d *distinctAcc) result() (Value, error) {
+	return d.inner.result()
+}
@@ -0,0 +1,204 @@
+package sqlitego
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Arithmetic, bitwise and conversion operators, with the rules of SQLite's
+// vdbe.c: TEXT and BLOB operands are read as the longest numeric prefix of
+// their text, integer results that overflow become REAL, and NULL operands or
+// undefined results give NULL.
+
+// arithmetic applies one of + - * / % to two non-NULL values.
+func arithmetic(op string, l, r Value) Value {
+	l, r = numericOperand(l), numericOperand(r)
+	if l.Type == TypeInteger && r.Type == TypeInteger {
+		a, b := l.Int, r.Int
+		switch op {
+		case "+":
+			if sum := a + b; (sum > a) == (b > 0) {
+				return IntegerValue(sum)
+			}
+		case "-":
+			if diff := a - b; (diff < a) == (b > 0) {
+				return IntegerValue(diff)
+			}
+		case "*":
+			if a == 0 || b == 0 {
+				return IntegerValue(0)
+			}
+			if p := a * b; p/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64) {
+				return IntegerValue(p)
+			}
+		case "/":
+			if b == 0 {
+				return NullValue()
+			}
+			if !(a == math.MinInt64 && b == -1) {
+				return IntegerValue(a / b)
+			}
+		case "%":
+			return integerRemainder(a, b)
+		}
+		// The integer result overflowed; compute it as REAL instead.
+	}
+	a, b := l.float(), r.float()
+	var f float64
+	switch op {
+	case "+":
+		f = a + b
+	case "-":
+		f = a - b
+	case "*":
+		f = a * b
+	case "/":
+		if b == 0 {
+			return NullValue()
+		}
+		f = a / b
+	case "%":
+		// REAL operands are truncated to integers, and the result stays REAL.
+		rem := integerRemainder(realToInt(a), realToInt(b))
+		if rem.IsNull() {
+			return rem
+		}
+		f = float64(rem.Int)
+	}
+	if math.IsNaN(f) {
+		return NullValue()
+	}
+	return RealValue(f)
+}
+
+func integerRemainder(a, b int64) Value {
+	if b == 0 {
+		return NullValue()
+	}
+	if b == -1 {
+		b = 1
+	}
+	return IntegerValue(a % b)
+}
+
+// bitwise applies one of & | << >> to two non-NULL values, as 64-bit integers.
+// A negative shift shifts the other way.
+func bitwise(op string, l, r Value) Value {
+	a, b := intValue(l), intValue(r)
+	switch op {
+	case "&":
+		return IntegerValue(a & b)
+	case "|":
+		return IntegerValue(a | b)
+	}
+	left := op == "<<"
+	if b < 0 {
+		left, b = !left, -b
+		if b < 0 {
+			b = 64
+		}
+	}
+	if b >= 64 {
+		if !left && a < 0 {
+			return IntegerValue(-1)
+		}
+		return IntegerValue(0)
+	}
+	if left {
+		return IntegerValue(a << b)
+	}
+	return IntegerValue(a >> b)
+}
+
+// numericOperand converts TEXT and BLOB to the number they start with.
+func numericOperand(v Value) Value {
+	if v.Type == TypeText || v.Type == TypeBlob {
+		return numericPrefix(string(v.Bytes))
+	}
+	return v
+}
+
+// intValue converts v to a 64-bit integer the way sqlite3_value_int64 does:
+// REALs are truncated and TEXT is read up to the first non-digit.
+func intValue(v Value) int64 {
+	switch v.Type {
+	case TypeInteger:
+		return v.Int
+	case TypeReal:
+		return realToInt(v.Real)
+	case TypeText, TypeBlob:
+		return integerPrefix(string(v.Bytes))
+	}
+	return 0
+}
+
+// realValue converts v to a float the way sqlite3_value_double does.
+func realValue(v Value) float64 {
+	if v.IsNull() {
+		return 0
+	}
+	return numericOperand(v).float()
+}
+
+// realToInt truncates f toward zero, saturating at the bounds of int64.
+func realToInt(f float64) int64 {
+	switch {
+	case math.IsNaN(f):
+		return 0
+	case f <= math.MinInt64:
+		return math.MinInt64
+	case f >= math.MaxInt64:
+		return math.MaxInt64
+	}
+	return int64(f)
+}
+
+// integerPrefix reads the optionally signed run of digits that starts s,
+// saturating at the bounds of int64.
+func integerPrefix(s string) int64 {
+	s = strings.TrimLeft(s, " \t\n\r\f\v")
+	end := 0
+	if end < len(s) && (s[end] == '+' || s[end] == '-') {
+		end++
+	}
+	for end < len(s) && isDigit(s[end]) {
+		end++
+	}
+	i, err := strconv.ParseInt(s[:end], 10, 64)
+	if isRangeError(err) {
+		if s[0] == '-' {
+			return math.MinInt64
+		}
+		return math.MaxInt64
+	}
+	return i
+}
+
+// castValue implements CAST(v AS type), where a is the affinity of type.
+func castValue(v Value, a Affinity) Value {
+	if v.IsNull() {
+		return v
+	}
+	switch a {
+	case AffinityText:
+		return TextValue(v.String())
+	case AffinityBlob:
+		if v.Type == TypeBlob {
+			return v
+		}
+		return BlobValue([]byte(v.String()))
+	case AffinityInteger:
+		return IntegerValue(intValue(v))
+	case AffinityReal:
+		return RealValue(realValue(v))
+	}
+	if v.isNumeric() {
+		return v
+	}
+	n := numericPrefix(string(v.Bytes))
+	if n.Type == TypeReal && n.Real == math.Trunc(n.Real) && math.Abs(n.Real) < 1<<51 {
+		return IntegerValue(int64(n.Real))
+	}
+	return n
+}
@@ -0,0 +1,246 @@
+package sqlitego
+
+// Statement is a parsed SQL statement.
+type Statement interface {
+	statementNode()
+}
+
+// SelectStmt is "[WITH ...] SELECT [DISTINCT] columns [FROM tables] [WHERE
+// expr] [GROUP BY exprs [HAVING expr]] [compound-operator SELECT ...] [ORDER BY
+// terms] [LIMIT expr [OFFSET expr]]". With compound SELECTs, ORDER BY and LIMIT
+// apply to the compound result.
+type SelectStmt struct {
+	With     *WithClause // nil when there is no WITH clause
+	Distinct bool
+	Columns  []ResultColumn
+	From     []*TableRef // empty for a SELECT without FROM
+	Where    Expr        // nil when there is no WHERE clause
+	GroupBy  []Expr
+	Having   Expr // nil when there is no HAVING clause
+	Windows  []NamedWindow
+	// Compound lists the SELECTs joined to this one, in order. They have no
+	// ORDER BY or LIMIT of their own.
+	Compound []CompoundSelect
+	OrderBy  []OrderingTerm
+	Limit    Expr // nil when there is no LIMIT clause
+	Offset   Expr // nil when there is no OFFSET
+}
+
+func (*SelectStmt) statementNode() {}
+
+// CompoundSelect is a SELECT joined to the ones before it by Op: "UNION",
+// "UNION ALL", "INTERSECT" or "EXCEPT".
+type CompoundSelect struct {
+	Op     string
+	Select *SelectStmt
+}
+
+// WithClause is "WITH [RECURSIVE] table AS (SELECT ...), ...". Like SQLite, a
+// common table whose SELECT refers to itself is recursive with or without
+// RECURSIVE.
+type WithClause struct {
+	Recursive bool
+	Tables    []*CommonTable
+}
+
+// CommonTable is "name [(columns)] AS [[NOT] MATERIALIZED] (SELECT ...)".
+type CommonTable struct {
+	Name    string
+	Columns []string // empty when the columns keep the names the SELECT gives them
+	Select  *SelectStmt
+}
+
+// ResultColumn is one entry of the SELECT list.
+type ResultColumn struct {
+	Star  bool   // "*" or "table.*"; Expr is nil
+	Table string // the table of "table.*"
+	Expr  Expr
+	Alias string
+	Text  string // source text of the expression
+}
+
+// OrderingTerm is one term of ORDER BY. Nulls is "FIRST", "LAST" or empty for
+// the default, which puts NULLs first in ascending order.
+type OrderingTerm struct {
+	Expr  Expr
+	Desc  bool
+	Nulls string
+}
+
+// TableRef names a table in the FROM clause, or holds a subquery read as one.
+// Every table after the first says how it is joined to the tables before it.
+type TableRef struct {
+	Name     string
+	Subquery *SelectStmt // "(SELECT ...)" in place of a table name; Name is empty
+	Alias    string
+	Join     string // "," "INNER", "LEFT" or "CROSS"; empty for the first table
+	Natural  bool
+	On       Expr // nil when there is no ON clause
+	Using    []string
+}
+
+// Expr is a node of an expression tree.
+type Expr interface {
+	exprNode()
+}
+
+// Literal is a constant: a number, string, blob or NULL.
+type Literal struct {
+	Value Value
+}
+
+// ColumnRef is "column" or "table.column".
+type ColumnRef struct {
+	Table  string
+	Column string
+	// DoubleQuoted marks "column". SQLite reads an unqualified double-quoted name
+	// that matches no column as a string literal.
+	DoubleQuoted bool
+	// position is 1 + the position in the joined row of a column compared by
+	// USING or NATURAL, whose name may be ambiguous in a self-join; 0 otherwise.
+	position int
+}
+
+// UnaryExpr is a prefix operator: "NOT", "-", "+" or "~".
+type UnaryExpr struct {
+	Op      string
+	Operand Expr
+}
+
+// BinaryExpr is an infix operator: a comparison, AND, OR, arithmetic, "||" or a
+// bitwise operator. Op is upper-case, and "==" and "<>" are normalized to "="
+// and "!=". "x IS NULL" is an IS with a NULL literal on the right, and "x IS
+// DISTINCT FROM y" is read as "x IS NOT y".
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// BetweenExpr is "expr [NOT] BETWEEN low AND high".
+type BetweenExpr struct {
+	Expr Expr
+	Low  Expr
+	High Expr
+	Not  bool
+}
+
+// CollateExpr is "expr COLLATE name".
+type CollateExpr struct {
+	Expr      Expr
+	Collation string
+}
+
+// InExpr is "expr [NOT] IN (list)" or "expr [NOT] IN (SELECT ...)".
+type InExpr struct {
+	Expr   Expr
+	List   []Expr
+	Select *SelectStmt // nil for a list
+	Not    bool
+}
+
+// LikeExpr is "expr [NOT] LIKE pattern [ESCAPE escape]" or "expr [NOT] GLOB
+// pattern". Op is "LIKE" or "GLOB".
+type LikeExpr struct {
+	Op      string
+	Expr    Expr
+	Pattern Expr
+	Escape  Expr // nil when there is no ESCAPE clause
+	Not     bool
+}
+
+// CaseExpr is "CASE [operand] WHEN ... THEN ... [ELSE result] END".
+type CaseExpr struct {
+	Operand Expr // nil for a CASE whose WHEN terms are conditions
+	Whens   []WhenClause
+	Else    Expr // nil when there is no ELSE
+}
+
+// WhenClause is one "WHEN when THEN then" of a CASE.
+type WhenClause struct {
+	When Expr
+	Then Expr
+}
+
+// CastExpr is "CAST(expr AS type)".
+type CastExpr struct {
+	Expr Expr
+	Type string
+}
+
+// Param is a bind parameter: "?", "?NNN", ":name", "@name" or "$name".
+// Index is the 1-based position it is bound from; Value is set when the
+// statement is executed.
+type Param struct {
+	Name  string // the parameter as written; empty for a bare "?"
+	Index int
+	Value Value
+}
+
+// FuncCall is "name(args)", "name(*)" or "name(DISTINCT args)". A call with
+// "OVER (...)" or "OVER name" is a window function call.
+type FuncCall struct {
+	Name     string
+	Args     []Expr
+	Star     bool
+	Distinct bool
+	Over     *WindowSpec // the window of "OVER (...)"
+	Window   string      // the window of "OVER name"
+}
+
+// NamedWindow is one "name AS (...)" of a WINDOW clause.
+type NamedWindow struct {
+	Name string
+	Spec *WindowSpec
+}
+
+// WindowSpec is the definition of a window: "[base] [PARTITION BY exprs]
+// [ORDER BY terms] [frame]".
+type WindowSpec struct {
+	Base        string // the named window it extends; empty when none
+	PartitionBy []Expr
+	OrderBy     []OrderingTerm
+	Frame       *FrameSpec // nil for the default frame
+}
+
+// FrameSpec is "ROWS|RANGE|GROUPS BETWEEN start AND end [EXCLUDE ...]". Exclude
+// is "CURRENT ROW", "GROUP", "TIES" or empty for EXCLUDE NO OTHERS.
+type FrameSpec struct {
+	Units      string
+	Start, End FrameBound
+	Exclude    string
+}
+
+// FrameBound is one end of a frame. Kind is "UNBOUNDED PRECEDING", "PRECEDING",
+// "CURRENT ROW", "FOLLOWING" or "UNBOUNDED FOLLOWING"; Offset is set for
+// PRECEDING and FOLLOWING.
+type FrameBound struct {
+	Kind   string
+	Offset Expr
+}
+
+// SubqueryExpr is "(SELECT ...)" used as a value: the first column of its first
+// row, or NULL when it has no rows.
+type SubqueryExpr struct {
+	Select *SelectStmt
+}
+
+// ExistsExpr is "EXISTS (SELECT ...)". NOT EXISTS is a NOT around it.
+type ExistsExpr struct {
+	Select *SelectStmt
+}
+
+func (*Literal) exprNode()      {}
+func (*ColumnRef) exprNode()    {}
+func (*UnaryExpr) exprNode()    {}
+func (*BinaryExpr) exprNode()   {}
+func (*BetweenExpr) exprNode()  {}
+func (*CollateExpr) exprNode()  {}
+func (*InExpr) exprNode()       {}
+func (*LikeExpr) exprNode()     {}
+func (*CaseExpr) exprNode()     {}
+func (*CastExpr) exprNode()     {}
+func (*Param) exprNode()        {}
+func (*FuncCall) exprNode()     {}
+func (*SubqueryExpr) exprNode() {}
+func (*ExistsExpr) exprNode()   {}
@@ -0,0 +1,65 @@
+package sqlitego
+
+import "slices"
+
+// autoIndex is an index built in memory on the columns a join compares for
+// equality, when no index of the schema serves them. As with SQLite's automatic
+// index, the table is read once to build it and every outer row then finds its
+// matches by binary search rather than by a scan.
+type autoIndex struct {
+	affinities []Affinity
+	collations []Collation
+	entries    []autoIndexEntry // in key order, rows with equal keys in the order read
+}
+
+type autoIndexEntry struct {
+	key Row
+	row Row
+}
+
+// newAutoIndex reads the rows of src, a table described by def, into an index
+// on the columns of keys. A row with a NULL key equals nothing and is left out.
+func newAutoIndex(src rowSource, def *TableDef, keys []joinKey) (*autoIndex, error) {
+	x := &autoIndex{}
+	for _, key := range keys {
+		x.affinities = append(x.affinities, def.Columns[key.term.colIdx].Affinity)
+		x.collations = append(x.collations, key.collation)
+	}
+	rows, err := readAll(src)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		key := make(Row, len(keys))
+		for i, k := range keys {
+			key[i] = row[k.term.colIdx]
+		}
+		if !slices.ContainsFunc(key, Value.IsNull) {
+			x.entries = append(x.entries, autoIndexEntry{key: key, row: row})
+		}
+	}
+	slices.SortStableFunc(x.entries, func(a, b autoIndexEntry) int {
+		return compareRows(a.key, b.key, x.collations)
+	})
+	return x, nil
+}
+
+// seek returns the rows whose key equals values, which are converted by the
+// affinities of the columns as the comparison converts them.
+func (x *autoIndex) seek(values []Value) []Row {
+	key := make(Row, len(values))
+	for i, v := range values {
+		if v.IsNull() {
+			return nil
+		}
+		_, key[i] = prepareComparison(NullValue(), x.affinities[i], v, AffinityNone)
+	}
+	pos, _ := slices.BinarySearchFunc(x.entries, key, func(e autoIndexEntry, key Row) int {
+		return compareRows(e.key, key, x.collations)
+	})
+	var rows []Row
+	for ; pos < len(x.entries) && compareRows(x.entries[pos].key, key, x.collations) == 0; pos++ {
+		rows = append(rows, x.entries[pos].row)
+	}
+	return rows
+}
@@ -0,0 +1,53 @@
+package sqlitego
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrRowidNotFound reports that a table B-tree holds no row with the rowid asked
+// for. Lookups wrap it together with the rowid; test for it with errors.Is.
+var ErrRowidNotFound = errors.New("rowid not found")
+
+// forEachTableRow calls fn for every row of the table B-tree rooted at pageNum,
+// in rowid order.
+func forEachTableRow(pager *Pager, pageNum int, fn func(rowid int64, rec Record) error) error {
+	c := NewCursor(pager, pageNum)
+	ok, err := c.First()
+	for ; ok && err == nil; ok, err = c.Next() {
+		rowid, err := c.Rowid()
+		if err != nil {
+			return err
+		}
+		rec, err := c.Record()
+		if err != nil {
+			return err
+		}
+		if err := fn(rowid, rec); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// LookupRowid finds the row with the given rowid in the table B-tree rooted at
+// root. A missing row is reported with ErrRowidNotFound.
+func LookupRowid(pager *Pager, root int, rowid int64) (Record, error) {
+	return lookupRowid(NewCursor(pager, root), rowid, -1)
+}
+
+// lookupRowid finds the row with the given rowid and decodes its first columns
+// values, or all of them when columns is negative.
+func lookupRowid(c *Cursor, rowid int64, columns int) (Record, error) {
+	ok, err := c.SeekRowid(rowid)
+	if err != nil {
+		return Record{}, err
+	}
+	if !ok {
+		return Record{}, fmt.Errorf("rowid %d: %w", rowid, ErrRowidNotFound)
+	}
+	if found, _ := c.Rowid(); found != rowid {
+		return Record{}, fmt.Errorf("rowid %d: %w", rowid, ErrRowidNotFound)
+	}
+	return c.RecordColumns(columns)
+}
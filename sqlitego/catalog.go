@@ -0,0 +1,191 @@
+package sqlitego
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sqlite_schema always lives in the table B-tree rooted at page 1.
+const schemaRootPage = 1
+
+const schemaTableSQL = "CREATE TABLE sqlite_schema(type text, name text, tbl_name text, rootpage integer, sql text)"
+
+// SchemaEntry is one row of sqlite_schema.
+type SchemaEntry struct {
+	Type     string // "table", "index", "view" or "trigger"
+	Name     string
+	TblName  string // table an index or trigger belongs to; the object itself otherwise
+	RootPage int    // 0 for views, triggers and virtual tables
+	SQL      string // empty for automatic indexes
+}
+
+// Catalog holds every entry of sqlite_schema, in B-tree order.
+type Catalog struct {
+	Entries []SchemaEntry
+
+	tableDefs map[string]*TableDef // parsed CREATE TABLE statements, by lower-cased name
+	indexDefs map[string]*IndexDef // parsed CREATE INDEX statements, by lower-cased name
+	viewDefs  map[string]*ViewDef  // parsed CREATE VIEW statements, by lower-cased name
+	// expanding holds the views whose SELECT is being planned, to catch a view
+	// that reads itself.
+	expanding map[string]bool
+}
+
+func LoadCatalog(pager *Pager) (*Catalog, error) {
+	catalog := &Catalog{}
+	err := forEachTableRow(pager, schemaRootPage, func(rowid int64, rec Record) error {
+		if len(rec.Values) < 5 {
+			return fmt.Errorf("sqlite_schema row %d has %d columns, expected 5", rowid, len(rec.Values))
+		}
+		entry := SchemaEntry{
+			Type:    rec.Values[0].String(),
+			Name:    rec.Values[1].String(),
+			TblName: rec.Values[2].String(),
+			SQL:     rec.Values[4].String(),
+		}
+		if rootPage := rec.Values[3]; rootPage.Type == TypeInteger {
+			entry.RootPage = int(rootPage.Int)
+		}
+		catalog.Entries = append(catalog.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sqlite_schema: %w", err)
+	}
+	return catalog, nil
+}
+
+// lookup finds an entry by type and name; names are matched case-insensitively
+// like SQLite identifiers.
+func (c *Catalog) lookup(entryType, name string) (SchemaEntry, bool) {
+	for _, entry := range c.Entries {
+		if entry.Type == entryType && strings.EqualFold(entry.Name, name) {
+			return entry, true
+		}
+	}
+	return SchemaEntry{}, false
+}
+
+// Table returns the table called name. sqlite_schema and its legacy alias
+// sqlite_master resolve to the schema table itself.
+func (c *Catalog) Table(name string) (SchemaEntry, bool) {
+	if strings.EqualFold(name, "sqlite_schema") || strings.EqualFold(name, "sqlite_master") {
+		return SchemaEntry{Type: "table", Name: name, TblName: name, RootPage: schemaRootPage, SQL: schemaTableSQL}, true
+	}
+	return c.lookup("table", name)
+}
+
+// TableDef returns the parsed CREATE TABLE statement of table, parsing it on first use.
+func (c *Catalog) TableDef(table SchemaEntry) (*TableDef, error) {
+	key := strings.ToLower(table.Name)
+	if def, ok := c.tableDefs[key]; ok {
+		return def, nil
+	}
+	def, err := parseCreateTable(table.SQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema of table %s: %w", table.Name, err)
+	}
+	if c.tableDefs == nil {
+		c.tableDefs = make(map[string]*TableDef)
+	}
+	c.tableDefs[key] = def
+	return def, nil
+}
+
+// IndexDef returns the definition of index. Automatic indexes have no SQL; their
+// key is taken from the constraint of the owning table they were created for.
+func (c *Catalog) IndexDef(index SchemaEntry) (*IndexDef, error) {
+	key := strings.ToLower(index.Name)
+	if def, ok := c.indexDefs[key]; ok {
+		return def, nil
+	}
+	var def *IndexDef
+	if index.SQL != "" {
+		var err error
+		if def, err = parseCreateIndex(index.SQL); err != nil {
+			return nil, fmt.Errorf("failed to parse schema of index %s: %w", index.Name, err)
+		}
+	} else {
+		table, ok := c.Table(index.TblName)
+		if !ok {
+			return nil, fmt.Errorf("index %s belongs to missing table %s", index.Name, index.TblName)
+		}
+		tableDef, err := c.TableDef(table)
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(index.Name[strings.LastIndexByte(index.Name, '_')+1:])
+		if err != nil || n < 1 || n > len(tableDef.AutoIndexes) {
+			return nil, fmt.Errorf("no constraint of table %s matches automatic index %s", index.TblName, index.Name)
+		}
+		def = &IndexDef{Name: index.Name, Table: index.TblName, Unique: true, Columns: tableDef.AutoIndexes[n-1]}
+	}
+	if c.indexDefs == nil {
+		c.indexDefs = make(map[string]*IndexDef)
+	}
+	c.indexDefs[key] = def
+	return def, nil
+}
+
+// ViewDef returns the parsed CREATE VIEW statement of view, parsing it on first use.
+func (c *Catalog) ViewDef(view SchemaEntry) (*ViewDef, error) {
+	key := strings.ToLower(view.Name)
+	if def, ok := c.viewDefs[key]; ok {
+		return def, nil
+	}
+	def, err := parseCreateView(view.SQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema of view %s: %w", view.Name, err)
+	}
+	if c.viewDefs == nil {
+		c.viewDefs = make(map[string]*ViewDef)
+	}
+	c.viewDefs[key] = def
+	return def, nil
+}
+
+func (c *Catalog) Index(name string) (SchemaEntry, bool) {
+	return c.lookup("index", name)
+}
+
+func (c *Catalog) View(name string) (SchemaEntry, bool) {
+	return c.lookup("view", name)
+}
+
+func (c *Catalog) Tables() []SchemaEntry {
+	return c.ofType("table")
+}
+
+func (c *Catalog) Indexes() []SchemaEntry {
+	return c.ofType("index")
+}
+
+func (c *Catalog) Views() []SchemaEntry {
+	return c.ofType("view")
+}
+
+func (c *Catalog) Triggers() []SchemaEntry {
+	return c.ofType("trigger")
+}
+
+// IndexesOn returns the indexes defined on tableName.
+func (c *Catalog) IndexesOn(tableName string) []SchemaEntry {
+	var indexes []SchemaEntry
+	for _, entry := range c.Entries {
+		if entry.Type == "index" && strings.EqualFold(entry.TblName, tableName) {
+			indexes = append(indexes, entry)
+		}
+	}
+	return indexes
+}
+
+func (c *Catalog) ofType(entryType string) []SchemaEntry {
+	var entries []SchemaEntry
+	for _, entry := range c.Entries {
+		if entry.Type == entryType {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,67 @@
+package sqlitego
+
+import (
+	"strings"
+	"testing"
+)
+
+// testdata/collation.db holds a(name TEXT) with 'one', 'two' and 'TWO', and
+// c(k TEXT COLLATE NOCASE) with 'One' and 'TWO'.
+
+// queryLines runs sql and returns its rows the way the CLI prints them.
+func queryLines(t *testing.T, db *DB, sql string) []string {
+	t.Helper()
+	rows, err := db.Query(sql)
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	defer rows.Close()
+	var lines []string
+	for rows.Next() {
+		values := make([]string, len(rows.Values()))
+		for i, v := range rows.Values() {
+			values[i] = v.String()
+		}
+		lines = append(lines, strings.Join(values, "|"))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	return lines
+}
+
+// A column declared without COLLATE compares with BINARY, and the collation of
+// the left operand decides, as in sqlite3.
+func TestComparisonCollation(t *testing.T) {
+	db, err := Open("testdata/collation.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, tc := range []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT a.name = c.k, c.k = a.name FROM a, c WHERE a.name = 'one' AND c.k = 'One'", "0|1"},
+		{"SELECT cast(a.name AS TEXT) = c.k FROM a, c WHERE a.name = 'one' AND c.k = 'One'", "0"},
+		{"SELECT * FROM a JOIN c ON a.name = c.k", "TWO|TWO"},
+		{"SELECT * FROM c JOIN a ON a.name = c.k", "TWO|TWO"},
+		{"SELECT * FROM a JOIN c ON c.k = a.name", "one|One,two|TWO,TWO|TWO"},
+		{"SELECT name FROM a WHERE EXISTS (SELECT 1 FROM c WHERE a.name = c.k)", "TWO"},
+		{"SELECT name FROM a WHERE name IN (SELECT k FROM c)", "TWO"},
+		{"SELECT name FROM a WHERE name IN (SELECT k FROM c WHERE k = a.name)", "TWO"},
+		{"SELECT k FROM c WHERE k IN (SELECT name FROM a)", "One,TWO"},
+		{"SELECT k FROM c WHERE k IN (SELECT name COLLATE BINARY FROM a)", "TWO"},
+		{"SELECT name FROM a UNION SELECT k FROM c", "One,TWO,one,two"},
+		{"SELECT name FROM a INTERSECT SELECT k FROM c", "TWO"},
+		{"SELECT k FROM c UNION SELECT name FROM a", "one,TWO"},
+		{"SELECT 'TWO' UNION SELECT k FROM c", "One,TWO"},
+		{"SELECT name FROM a ORDER BY 1 COLLATE NOCASE DESC, 1", "TWO,two,one"},
+		{"SELECT name, count(*) FROM a GROUP BY 1 COLLATE NOCASE", "one|1,two|2"},
+		{"SELECT DISTINCT name FROM (SELECT name FROM a UNION ALL SELECT k FROM c)", "one,two,TWO,One"},
+	} {
+		if got := strings.Join(queryLines(t, db, tc.sql), ","); got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.sql, got, tc.want)
+		}
+	}
+}
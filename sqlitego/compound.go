@@ -0,0 +1,327 @@
+package sqlitego
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// compoundSelect plans SELECTs joined by UNION, UNION ALL, INTERSECT and EXCEPT,
+// which apply from left to right. Like SQLite, the set operations sort their
+// rows and keep one row of each group of equal rows: for UNION the last one,
+// and for INTERSECT and EXCEPT the one from the left. Rows are compared with
+// the collation of the leftmost SELECT that gives each column one; a column of
+// a table always has one, BINARY unless declared otherwise.
+func compoundSelect(ctx *queryContext, stmt *SelectStmt) (*query, error) {
+	first := *stmt
+	first.With, first.Compound, first.OrderBy, first.Limit, first.Offset = nil, nil, nil, nil, nil
+	var parts []*query
+	for i := -1; i < len(stmt.Compound); i++ {
+		part := &first
+		if i >= 0 {
+			part = stmt.Compound[i].Select
+		}
+		q, err := planSelect(ctx, part)
+		if err != nil {
+			return nil, err
+		}
+		if i >= 0 && len(q.columns) != len(parts[0].columns) {
+			return nil, fmt.Errorf("SELECTs to the left and right of %s do not have the same number of result columns", stmt.Compound[i].Op)
+		}
+		parts = append(parts, q)
+	}
+	// Only a column computed by an expression such as a literal has no collation
+	// and leaves the choice to the SELECTs on its right.
+	collations := make([]Collation, len(parts[0].columns))
+	for _, q := range parts {
+		for i, col := range q.columns {
+			if collations[i] == nil {
+				collations[i] = col.collation
+			}
+		}
+	}
+
+	src := parts[0].rows
+	for i, c := range stmt.Compound {
+		right := parts[i+1].rows
+		switch c.Op {
+		case "UNION ALL":
+			src = &concatRows{srcs: []rowSource{src, right}}
+		case "UNION":
+			src = newUniqueRows(&concatRows{srcs: []rowSource{src, right}}, collations)
+		default:
+			src = &setDifference{
+				left:       newUniqueRows(src, collations),
+				right:      newUniqueRows(right, collations),
+				collations: collations,
+				intersect:  c.Op == "INTERSECT",
+			}
+		}
+	}
+
+	keys, err := compoundOrderBy(stmt, parts, collations)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		src = newSorter(src, keys)
+	}
+	if stmt.Limit != nil {
+		if src, err = applyLimit(stmt, src, ctx); err != nil {
+			return nil, err
+		}
+	}
+	columns := parts[0].columns
+	for i := range columns {
+		columns[i].collation = collations[i]
+	}
+	return &query{columns: columns, rows: src}, nil
+}
+
+// compoundOrderBy compiles the ORDER BY of a compound SELECT. Each term must
+// number a result column, or name or repeat one of the SELECT lists, which are
+// searched from left to right.
+func compoundOrderBy(stmt *SelectStmt, parts []*query, collations []Collation) ([]sortKey, error) {
+	var keys []sortKey
+	width := len(collations)
+	for i, term := range stmt.OrderBy {
+		expr := term.Expr
+		key := &compiledExpr{}
+		if c, ok := expr.(*CollateExpr); ok {
+			coll, ok := lookupCollation(c.Collation)
+			if !ok {
+				return nil, fmt.Errorf("no such collation sequence: %s", c.Collation)
+			}
+			expr, key.collation, key.explicit = c.Expr, coll, true
+		}
+		col := -1
+		if lit, ok := expr.(*Literal); ok && lit.Value.Type == TypeInteger {
+			if n := lit.Value.Int; n < 1 || n > int64(width) {
+				return nil, fmt.Errorf("%s ORDER BY term out of range - should be between 1 and %d", ordinal(i+1), width)
+			}
+			col = int(lit.Value.Int) - 1
+		}
+		for _, q := range parts {
+			if col >= 0 {
+				break
+			}
+			col = matchOutputColumn(expr, q.columns)
+		}
+		if col < 0 {
+			return nil, fmt.Errorf("%s ORDER BY term does not match any column in the result set", ordinal(i+1))
+		}
+		if !key.explicit {
+			key.collation = collations[col]
+		}
+		key.eval = func(row Row) (Value, error) { return row[col], nil }
+		keys = append(keys, sortKey{expr: key, desc: term.Desc, nullsFirst: nullsFirst(term)})
+	}
+	return keys, nil
+}
+
+// matchOutputColumn returns the position of the column expr names by alias or
+// repeats, or -1.
+func matchOutputColumn(expr Expr, columns []outputColumn) int {
+	if ref, ok := expr.(*ColumnRef); ok && ref.Table == "" {
+		for i, col := range columns {
+			if col.alias != "" && strings.EqualFold(col.alias, ref.Column) {
+				return i
+			}
+		}
+	}
+	for i, col := range columns {
+		if sameExpr(expr, col.expr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameExpr reports whether a and b are the same expression. A column matches
+// the same column with or without its table.
+func sameExpr(a, b Expr) bool {
+	refA, okA := a.(*ColumnRef)
+	refB, okB := b.(*ColumnRef)
+	if okA && okB {
+		return strings.EqualFold(refA.Column, refB.Column) &&
+			(refA.Table == "" || refB.Table == "" || strings.EqualFold(refA.Table, refB.Table))
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// distinct passes on the rows whose result columns differ from those of every
+// earlier row, for SELECT DISTINCT.
+type distinct struct {
+	src     rowSource
+	columns []*compiledExpr
+	seen    *rowSet
+}
+
+func newDistinct(src rowSource, columns []*compiledExpr) *distinct {
+	collations := make([]Collation, len(columns))
+	for i, col := range columns {
+		collations[i] = col.collation
+	}
+	return &distinct{src: src, columns: columns, seen: newRowSet(collations)}
+}
+
+func (d *distinct) Next() (bool, error) {
+	for {
+		ok, err := d.src.Next()
+		if !ok || err != nil {
+			return false, err
+		}
+		in := d.src.Row()
+		key := make(Row, len(d.columns))
+		for i, col := range d.columns {
+			if key[i], err = col.eval(in); err != nil {
+				return false, err
+			}
+		}
+		if d.seen.add(key) {
+			return true, nil
+		}
+	}
+}
+
+func (d *distinct) Row() Row {
+	return d.src.Row()
+}
+
+func (d *distinct) Close() error {
+	return d.src.Close()
+}
+
+// concatRows passes on the rows of each source in turn.
+type concatRows struct {
+	srcs []rowSource
+	pos  int
+}
+
+func (c *concatRows) Next() (bool, error) {
+	for ; c.pos < len(c.srcs); c.pos++ {
+		ok, err := c.srcs[c.pos].Next()
+		if ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (c *concatRows) Row() Row {
+	return c.srcs[c.pos].Row()
+}
+
+func (c *concatRows) Close() error {
+	var errs []error
+	for _, src := range c.srcs {
+		errs = append(errs, src.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// uniqueRows sorts the rows of its source by every column and passes on the
+// last row of each group of equal rows.
+type uniqueRows struct {
+	src        rowSource
+	collations []Collation
+	row        Row
+	next       Row // the row read ahead of row, or nil
+	done       bool
+}
+
+func newUniqueRows(src rowSource, collations []Collation) *uniqueRows {
+	keys := make([]sortKey, len(collations))
+	for i, coll := range collations {
+		keys[i] = sortKey{expr: &compiledExpr{eval: func(row Row) (Value, error) { return row[i], nil }, collation: coll}, nullsFirst: true}
+	}
+	return &uniqueRows{src: newSorter(src, keys), collations: collations}
+}
+
+func (u *uniqueRows) Next() (bool, error) {
+	if u.next == nil {
+		if ok, err := u.read(); !ok || err != nil {
+			return false, err
+		}
+	}
+	u.row, u.next = u.next, nil
+	for {
+		ok, err := u.read()
+		if !ok || err != nil {
+			return err == nil, err
+		}
+		if compareRows(u.row, u.next, u.collations) != 0 {
+			return true, nil
+		}
+		u.row, u.next = u.next, nil
+	}
+}
+
+// read reads the next row of the source into next.
+func (u *uniqueRows) read() (bool, error) {
+	if u.done {
+		return false, nil
+	}
+	ok, err := u.src.Next()
+	if !ok || err != nil {
+		u.done = true
+		return false, err
+	}
+	u.next = u.src.Row()
+	return true, nil
+}
+
+func (u *uniqueRows) Row() Row {
+	return u.row
+}
+
+func (u *uniqueRows) Close() error {
+	return u.src.Close()
+}
+
+// setDifference merges two sorted sources without duplicates, passing on the
+// rows of left that are in right for INTERSECT, or that are not for EXCEPT.
+type setDifference struct {
+	left, right *uniqueRows
+	collations  []Collation
+	intersect   bool
+	started     bool
+	rightOK     bool
+}
+
+func (s *setDifference) Next() (bool, error) {
+	if !s.started {
+		s.started = true
+		var err error
+		if s.rightOK, err = s.right.Next(); err != nil {
+			return false, err
+		}
+	}
+	for {
+		ok, err := s.left.Next()
+		if !ok || err != nil {
+			return false, err
+		}
+		c := -1
+		for s.rightOK {
+			if c = compareRows(s.left.Row(), s.right.Row(), s.collations); c <= 0 {
+				break
+			}
+			if s.rightOK, err = s.right.Next(); err != nil {
+				return false, err
+			}
+		}
+		if (c == 0) == s.intersect {
+			return true, nil
+		}
+	}
+}
+
+func (s *setDifference) Row() Row {
+	return s.left.Row()
+}
+
+func (s *setDifference) Close() error {
+	return errors.Join(s.left.Close(), s.right.Close())
+}
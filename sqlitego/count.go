@@ -0,0 +1,14 @@
+package sqlitego
+
+import (
+	"fmt"
+)
+
+func countRows(pager *Pager, catalog *Catalog, tableName string) (int, error) {
+	table, ok := catalog.Table(tableName)
+	if !ok {
+		return 0, fmt.Errorf("table %s not found in database", tableName)
+	}
+
+	return NewCursor(pager, table.RootPage).Count()
+}
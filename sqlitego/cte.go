@@ -0,0 +1,340 @@
+package sqlitego
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// maxRecursionDepth bounds how many steps away from the initial rows a
+// recursive common table may go, so that a recursion that never ends fails
+// instead of running forever.
+const maxRecursionDepth = 1000000
+
+// cteScope holds the common tables of one WITH clause. They hide tables of the
+// same name in the statement, in its subqueries and in each other's SELECTs.
+type cteScope struct {
+	tables map[string]*cte
+	parent *cteScope
+}
+
+// lookup returns the innermost common table called name, or nil.
+func (s *cteScope) lookup(name string) *cte {
+	for ; s != nil; s = s.parent {
+		if c, ok := s.tables[strings.ToLower(name)]; ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// withContext returns ctx with the common tables of with in scope.
+func withContext(ctx *queryContext, with *WithClause) (*queryContext, error) {
+	inner := *ctx
+	inner.with = &cteScope{tables: map[string]*cte{}, parent: ctx.with}
+	for _, table := range with.Tables {
+		key := strings.ToLower(table.Name)
+		if _, dup := inner.with.tables[key]; dup {
+			return nil, fmt.Errorf("duplicate WITH table name: %s", table.Name)
+		}
+		inner.with.tables[key] = &cte{table: table, ctx: &inner}
+	}
+	return &inner, nil
+}
+
+// cte is a common table. It is planned anew wherever it is read.
+type cte struct {
+	table *CommonTable
+	ctx   *queryContext // the context of the WITH clause
+	// planning is set while the table's SELECT is planned, when it may only
+	// refer to itself as a recursive table.
+	planning bool
+	// working is the table a recursive SELECT reads as the common table while it
+	// is planned, and columns the columns of the table.
+	working *rowList
+	columns []outputColumn
+}
+
+// plan plans the rows of the common table.
+func (c *cte) plan() (*query, error) {
+	if c.working != nil {
+		return &query{columns: c.columns, rows: c.working}, nil
+	}
+	if c.planning {
+		return nil, fmt.Errorf("circular reference: %s", c.table.Name)
+	}
+	c.planning = true
+	defer func() { c.planning = false }()
+	stmt := c.table.Select
+	if first := recursiveTerm(stmt, c.table.Name); first > 0 {
+		return c.planRecursive(first)
+	}
+	q, err := planSelect(c.ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	if q.columns, err = c.rename(q.columns); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// rename gives columns the names of the table's column list, if it has one.
+func (c *cte) rename(columns []outputColumn) ([]outputColumn, error) {
+	names := c.table.Columns
+	if len(names) == 0 {
+		return columns, nil
+	}
+	if len(names) != len(columns) {
+		return nil, fmt.Errorf("table %s has %d values for %d columns", c.table.Name, len(columns), len(names))
+	}
+	renamed := make([]outputColumn, len(columns))
+	for i, col := range columns {
+		col.Name = names[i]
+		renamed[i] = col
+	}
+	return renamed, nil
+}
+
+// recursiveTerm returns the position among the SELECTs of stmt of the first
+// one that makes the common table called name recursive, or 0 when it is not
+// recursive. As in SQLite, the recursive SELECTs are the rightmost ones, joined
+// by the same UNION or UNION ALL, that read the table in their FROM clause.
+func recursiveTerm(stmt *SelectStmt, name string) int {
+	n := len(stmt.Compound)
+	if n == 0 {
+		return 0
+	}
+	op := stmt.Compound[n-1].Op
+	if op != "UNION" && op != "UNION ALL" {
+		return 0
+	}
+	first := 0
+	for i := n - 1; i >= 0 && stmt.Compound[i].Op == op; i-- {
+		if len(recursiveRefs(stmt.Compound[i].Select, name)) == 0 {
+			break
+		}
+		first = i + 1
+	}
+	return first
+}
+
+// recursiveRefs returns the tables of the FROM clause of stmt that name the
+// common table called name.
+func recursiveRefs(stmt *SelectStmt, name string) []*TableRef {
+	var refs []*TableRef
+	for _, ref := range stmt.From {
+		if ref.Subquery == nil && strings.EqualFold(ref.Name, name) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// planRecursive plans a recursive common table whose recursive SELECTs start
+// at position first. The SELECTs before it give the initial rows.
+func (c *cte) planRecursive(first int) (*query, error) {
+	stmt := c.table.Select
+	ctx := c.ctx
+	if stmt.With != nil {
+		var err error
+		if ctx, err = withContext(ctx, stmt.With); err != nil {
+			return nil, err
+		}
+	}
+	setupStmt := *stmt
+	setupStmt.With, setupStmt.Compound = nil, stmt.Compound[:first-1]
+	setupStmt.OrderBy, setupStmt.Limit, setupStmt.Offset = nil, nil, nil
+	setup, err := planSelect(ctx, &setupStmt)
+	if err != nil {
+		return nil, err
+	}
+	if c.columns, err = c.rename(setup.columns); err != nil {
+		return nil, err
+	}
+	parts := []*query{setup}
+	collations := make([]Collation, len(setup.columns))
+	for i, col := range setup.columns {
+		collations[i] = col.collation
+	}
+	var steps []*recursiveStep
+	for _, compound := range stmt.Compound[first-1:] {
+		term := compound.Select
+		if len(recursiveRefs(term, c.table.Name)) > 1 {
+			return nil, fmt.Errorf("multiple references to recursive table: %s", c.table.Name)
+		}
+		working := &rowList{}
+		q, err := c.planStep(ctx, term, working)
+		if err != nil {
+			return nil, err
+		}
+		if len(q.columns) != len(c.columns) {
+			return nil, fmt.Errorf("SELECTs to the left and right of %s do not have the same number of result columns", compound.Op)
+		}
+		for i, col := range q.columns {
+			if collations[i] == nil {
+				collations[i] = col.collation
+			}
+		}
+		parts = append(parts, q)
+		steps = append(steps, &recursiveStep{term: term, working: working, rows: q.rows})
+	}
+	keys, err := compoundOrderBy(stmt, parts, collations)
+	if err != nil {
+		return nil, err
+	}
+	r := &recursiveRows{c: c, ctx: ctx, setup: setup.rows, steps: steps, keys: keys}
+	if stmt.Compound[len(stmt.Compound)-1].Op == "UNION" {
+		r.seen = newRowSet(collations)
+	}
+	var src rowSource = r
+	if stmt.Limit != nil {
+		if src, err = applyLimit(stmt, src, ctx); err != nil {
+			return nil, err
+		}
+	}
+	return &query{columns: c.columns, rows: src}, nil
+}
+
+// planStep plans a recursive SELECT to read working as the common table.
+func (c *cte) planStep(ctx *queryContext, term *SelectStmt, working *rowList) (*query, error) {
+	c.working = working
+	defer func() { c.working = nil }()
+	return planSelect(ctx, term)
+}
+
+// recursiveStep is a recursive SELECT, planned once to read working as the
+// common table. Each step puts the row it runs for in working and runs the plan
+// again.
+type recursiveStep struct {
+	term    *SelectStmt
+	working *rowList
+	rows    rowSource
+}
+
+// recursiveRows evaluates a recursive common table from a queue: it takes the
+// next row from the queue, passes it on and, before taking another, queues the
+// rows the recursive SELECTs return for it. The queue is first in, first out,
+// or ordered by the ORDER BY of the table. For UNION, rows that were queued
+// before are dropped.
+type recursiveRows struct {
+	c     *cte
+	ctx   *queryContext
+	setup rowSource // the initial rows, read before the first row is passed on
+	steps []*recursiveStep
+	keys  []sortKey
+	seen  *rowSet // nil for UNION ALL
+
+	queue   []queuedRow
+	current *queuedRow
+	started bool
+}
+
+type queuedRow struct {
+	row   Row
+	depth int // recursive steps from the initial rows
+}
+
+func (r *recursiveRows) Next() (bool, error) {
+	if !r.started {
+		r.started = true
+		rows, err := readAll(r.setup)
+		if err != nil {
+			return false, err
+		}
+		for _, row := range rows {
+			if err := r.push(queuedRow{row: row}); err != nil {
+				return false, err
+			}
+		}
+	}
+	if r.current != nil {
+		if err := r.step(*r.current); err != nil {
+			return false, err
+		}
+		r.current = nil
+	}
+	if len(r.queue) == 0 {
+		return false, nil
+	}
+	current := r.queue[0]
+	r.current, r.queue = &current, r.queue[1:]
+	return true, nil
+}
+
+// step queues the rows the recursive SELECTs return for one row of the table.
+func (r *recursiveRows) step(from queuedRow) error {
+	if from.depth >= maxRecursionDepth {
+		return fmt.Errorf("recursive table %s goes deeper than %d steps", r.c.table.Name, maxRecursionDepth)
+	}
+	for _, s := range r.steps {
+		s.working.rows, s.working.pos = []Row{from.row}, 0
+		if !rewind(s.rows) {
+			// A plan that cannot start over, such as one that sorts its rows, is
+			// planned again for every row.
+			if err := s.rows.Close(); err != nil {
+				return err
+			}
+			q, err := r.c.planStep(r.ctx, s.term, s.working)
+			if err != nil {
+				return err
+			}
+			s.rows = q.rows
+		}
+		rows, err := readAll(s.rows)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := r.push(queuedRow{row: row, depth: from.depth + 1}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// push adds a row to the queue, after the rows that sort before or with it.
+func (r *recursiveRows) push(q queuedRow) error {
+	if r.seen != nil && !r.seen.add(q.row) {
+		return nil
+	}
+	if len(r.keys) == 0 {
+		r.queue = append(r.queue, q)
+		return nil
+	}
+	values := make([]Value, len(r.keys))
+	for i, key := range r.keys {
+		v, err := key.expr.eval(q.row)
+		if err != nil {
+			return err
+		}
+		values[i] = v
+	}
+	pos, _ := slices.BinarySearchFunc(r.queue, values, func(queued queuedRow, values []Value) int {
+		for i, key := range r.keys {
+			v, _ := key.expr.eval(queued.row)
+			if c := key.compare(v, values[i]); c != 0 {
+				return c
+			}
+		}
+		// Rows that sort alike leave in the order they came.
+		return -1
+	})
+	r.queue = slices.Insert(r.queue, pos, q)
+	return nil
+}
+
+func (r *recursiveRows) Row() Row {
+	return append(Row(nil), r.current.row...)
+}
+
+func (r *recursiveRows) Close() error {
+	r.queue, r.current = nil, nil
+	errs := []error{r.setup.Close()}
+	for _, s := range r.steps {
+		errs = append(errs, s.rows.Close())
+	}
+	return errors.Join(errs...)
+}
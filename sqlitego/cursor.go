@@ -0,0 +1,349 @@
+package sqlitego
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Cursor walks the entries of one B-tree, table or index, in key order. It only
+// holds the path from the root page to the current cell, so memory use is
+// bounded by the depth of the tree whatever its size.
+//
+// A table B-tree keeps its rows in leaf pages only. In an index B-tree the cells
+// of interior pages are entries too, visited between their left child and the
+// next child, so the cursor can rest on an interior page.
+type Cursor struct {
+	pager *Pager
+	root  int
+	path  []cursorFrame
+	valid bool
+}
+
+// cursorFrame is one page on the path. On the last frame idx is the current
+// cell; on the others it is the child the path continues into, where
+// NumberOfCells means the right-most pointer.
+type cursorFrame struct {
+	page *Page
+	idx  int
+}
+
+func NewCursor(pager *Pager, root int) *Cursor {
+	return &Cursor{pager: pager, root: root}
+}
+
+func (c *Cursor) top() *cursorFrame {
+	return &c.path[len(c.path)-1]
+}
+
+func (c *Cursor) numCells(f *cursorFrame) int {
+	return len(f.page.Header.CellPointers)
+}
+
+func (c *Cursor) push(pageNum int) (*cursorFrame, error) {
+	page, err := c.pager.ReadBTreePage(pageNum)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.path) > 0 && page.Header.IsTable() != c.path[0].page.Header.IsTable() {
+		return nil, fmt.Errorf("page %d does not belong to the b-tree rooted at page %d", pageNum, c.root)
+	}
+	if len(c.path) >= maxBTreeDepth {
+		return nil, fmt.Errorf("b-tree rooted at page %d is deeper than %d pages", c.root, maxBTreeDepth)
+	}
+	c.path = append(c.path, cursorFrame{page: page})
+	return c.top(), nil
+}
+
+// maxBTreeDepth guards against cycles in a corrupt file; SQLite itself gives up
+// at a depth of 20.
+const maxBTreeDepth = 20
+
+// child returns the page number of child i of an interior frame.
+func (c *Cursor) child(f *cursorFrame, i int) int {
+	if i == c.numCells(f) {
+		return int(f.page.Header.RightMostPointer)
+	}
+	return int(binary.BigEndian.Uint32(f.page.Data[f.page.Header.CellPointers[i]:]))
+}
+
+func (c *Cursor) reset() (*cursorFrame, error) {
+	c.path = c.path[:0]
+	c.valid = false
+	return c.push(c.root)
+}
+
+// descend follows child i of the last frame, then keeps to the left-most
+// (or right-most) edge down to a leaf.
+func (c *Cursor) descend(i int, rightmost bool) (bool, error) {
+	f := c.top()
+	for !f.page.Header.IsLeaf() {
+		f.idx = i
+		var err error
+		if f, err = c.push(c.child(f, i)); err != nil {
+			return false, err
+		}
+		i = 0
+		if rightmost {
+			i = c.numCells(f)
+		}
+	}
+	if c.numCells(f) == 0 {
+		// Only the root of an empty tree is a leaf without cells.
+		return false, nil
+	}
+	f.idx = 0
+	if rightmost {
+		f.idx = c.numCells(f) - 1
+	}
+	c.valid = true
+	return true, nil
+}
+
+// First moves to the first entry and reports whether there is one.
+func (c *Cursor) First() (bool, error) {
+	if _, err := c.reset(); err != nil {
+		return false, err
+	}
+	return c.descend(0, false)
+}
+
+// Last moves to the last entry and reports whether there is one.
+func (c *Cursor) Last() (bool, error) {
+	f, err := c.reset()
+	if err != nil {
+		return false, err
+	}
+	return c.descend(c.numCells(f), true)
+}
+
+// Next moves to the following entry and reports false once past the last one.
+func (c *Cursor) Next() (bool, error) {
+	if !c.valid {
+		return false, nil
+	}
+	f := c.top()
+	if !f.page.Header.IsLeaf() {
+		// On an interior index entry: the next entries are in the following child.
+		return c.descend(f.idx+1, false)
+	}
+	if f.idx++; f.idx < c.numCells(f) {
+		return true, nil
+	}
+	for {
+		c.path = c.path[:len(c.path)-1]
+		if len(c.path) == 0 {
+			c.valid = false
+			return false, nil
+		}
+		f = c.top()
+		if f.idx == c.numCells(f) {
+			continue
+		}
+		if !f.page.Header.IsTable() {
+			// Coming back from the left child of an index entry: the entry is next.
+			return true, nil
+		}
+		return c.descend(f.idx+1, false)
+	}
+}
+
+// Prev moves to the preceding entry and reports false once before the first one.
+func (c *Cursor) Prev() (bool, error) {
+	if !c.valid {
+		return false, nil
+	}
+	f := c.top()
+	if !f.page.Header.IsLeaf() {
+		// On an interior index entry: the previous entries are in its left child.
+		return c.descend(f.idx, true)
+	}
+	if f.idx--; f.idx >= 0 {
+		return true, nil
+	}
+	for {
+		c.path = c.path[:len(c.path)-1]
+		if len(c.path) == 0 {
+			c.valid = false
+			return false, nil
+		}
+		f = c.top()
+		if f.idx == 0 {
+			continue
+		}
+		if !f.page.Header.IsTable() {
+			f.idx--
+			return true, nil
+		}
+		return c.descend(f.idx-1, true)
+	}
+}
+
+// SeekRowid moves a table cursor to the row with the given rowid, or to the next
+// larger one when it does not exist, and reports whether it found a row at all.
+// A seek that lands on the leaf page the cursor is already on searches that page
+// only, so rowids visited in ascending order cost little more than a scan.
+func (c *Cursor) SeekRowid(rowid int64) (bool, error) {
+	if c.valid {
+		f := c.top()
+		n := c.numCells(f)
+		if f.page.Header.PageType == pageTypeLeafTable && cellRowid(f.page, 0) <= rowid && rowid <= cellRowid(f.page, n-1) {
+			f.idx = sort.Search(n, func(i int) bool { return cellRowid(f.page, i) >= rowid })
+			return true, nil
+		}
+	}
+	f, err := c.reset()
+	if err != nil {
+		return false, err
+	}
+	if !f.page.Header.IsTable() {
+		return false, fmt.Errorf("page %d is not the root of a table b-tree", c.root)
+	}
+	return c.seek(func(f *cursorFrame, i int) (bool, error) {
+		return cellRowid(f.page, i) >= rowid, nil
+	})
+}
+
+// SeekIndex moves an index cursor to the first entry for which atOrAfter returns
+// true. atOrAfter must be false for a run of leading entries and true for all
+// the rest, like the predicate of sort.Search.
+func (c *Cursor) SeekIndex(atOrAfter func(values []Value) bool) (bool, error) {
+	f, err := c.reset()
+	if err != nil {
+		return false, err
+	}
+	if f.page.Header.IsTable() {
+		return false, fmt.Errorf("page %d is not the root of an index b-tree", c.root)
+	}
+	return c.seek(func(f *cursorFrame, i int) (bool, error) {
+		rec, err := c.pager.readIndexCell(f.page.Data, indexCellPayload(f.page, i))
+		if err != nil {
+			return false, err
+		}
+		return atOrAfter(rec.Values), nil
+	})
+}
+
+// seek binary-searches each page from the root down for the first cell matching
+// pred, following the child to the left of it.
+func (c *Cursor) seek(pred func(f *cursorFrame, i int) (bool, error)) (bool, error) {
+	var searchErr error
+	search := func(f *cursorFrame) int {
+		return sort.Search(c.numCells(f), func(i int) bool {
+			ok, err := pred(f, i)
+			if err != nil && searchErr == nil {
+				searchErr = err
+			}
+			return ok || err != nil
+		})
+	}
+	f := c.top()
+	for !f.page.Header.IsLeaf() {
+		f.idx = search(f)
+		if searchErr != nil {
+			return false, searchErr
+		}
+		var err error
+		if f, err = c.push(c.child(f, f.idx)); err != nil {
+			return false, err
+		}
+	}
+	n := c.numCells(f)
+	if n == 0 {
+		return false, nil
+	}
+	f.idx = search(f)
+	if searchErr != nil {
+		return false, searchErr
+	}
+	c.valid = true
+	if f.idx < n {
+		return true, nil
+	}
+	// Every entry of this leaf sorts before the target; the answer is whatever
+	// follows the leaf.
+	f.idx = n - 1
+	return c.Next()
+}
+
+// Rowid returns the rowid of the current entry: the key of a table row, or the
+// last column of an index entry.
+func (c *Cursor) Rowid() (int64, error) {
+	f := c.top()
+	if f.page.Header.IsTable() {
+		return cellRowid(f.page, f.idx), nil
+	}
+	rec, err := c.Record()
+	if err != nil {
+		return 0, err
+	}
+	if len(rec.Values) == 0 || rec.Values[len(rec.Values)-1].Type != TypeInteger {
+		return 0, fmt.Errorf("index entry on page %d has no rowid", f.page.Number)
+	}
+	return rec.Values[len(rec.Values)-1].Int, nil
+}
+
+// Record decodes the current entry, following overflow pages as needed.
+func (c *Cursor) Record() (Record, error) {
+	f := c.top()
+	if f.page.Header.IsTable() {
+		_, rec, err := c.pager.readTableLeafCell(f.page.Data, int(f.page.Header.CellPointers[f.idx]))
+		return rec, err
+	}
+	return c.pager.readIndexCell(f.page.Data, indexCellPayload(f.page, f.idx))
+}
+
+// RecordColumns decodes the first n values of the current table row, following
+// overflow pages only as far as they reach. A negative n decodes them all.
+func (c *Cursor) RecordColumns(n int) (Record, error) {
+	f := c.top()
+	if !f.page.Header.IsTable() {
+		return Record{}, fmt.Errorf("page %d is not a table b-tree page", f.page.Number)
+	}
+	_, rec, err := c.pager.readTableLeafColumns(f.page.Data, int(f.page.Header.CellPointers[f.idx]), n)
+	return rec, err
+}
+
+// Count returns the number of entries in the B-tree. For a table only the cell
+// counts of the leaf pages are read, without decoding any row.
+func (c *Cursor) Count() (int, error) {
+	ok, err := c.First()
+	count := 0
+	for ok && err == nil {
+		f := c.top()
+		if !f.page.Header.IsTable() {
+			count++
+			ok, err = c.Next()
+			continue
+		}
+		count += c.numCells(f)
+		f.idx = c.numCells(f) - 1
+		ok, err = c.Next()
+	}
+	return count, err
+}
+
+// cellRowid returns the rowid of cell i of a table B-tree page: the key of an
+// interior cell, or the rowid of a leaf cell.
+func cellRowid(page *Page, i int) int64 {
+	pos := int(page.Header.CellPointers[i])
+	if page.Header.PageType == pageTypeInteriorTable {
+		// [child_page (4 bytes)][key_rowid (varint)]
+		rowid, _ := readVarint(page.Data[pos+4:])
+		return int64(rowid)
+	}
+	// [payload_size (varint)][rowid (varint)][payload]
+	_, n := readVarint(page.Data[pos:])
+	rowid, _ := readVarint(page.Data[pos+n:])
+	return int64(rowid)
+}
+
+// indexCellPayload returns the offset of the payload of cell i of an index page.
+func indexCellPayload(page *Page, i int) int {
+	pos := int(page.Header.CellPointers[i])
+	if !page.Header.IsLeaf() {
+		// Interior index cells carry real entries too: [child_page (4 bytes)][payload]
+		pos += 4
+	}
+	return pos
+}
@@ -0,0 +1,142 @@
+package sqlitego
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// timeFormat is how a time.Time argument is bound: as TEXT that SQLite's date
+// and time functions understand.
+const timeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// DB is a read-only handle to a SQLite database file. A DB is not safe for
+// concurrent use; open one handle per goroutine.
+type DB struct {
+	pager   *Pager
+	catalog *Catalog
+}
+
+// Open opens the database file at path and loads its schema. Only UTF-8
+// databases are supported.
+func Open(path string) (*DB, error) {
+	pager, err := OpenPager(path, defaultPageCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	if enc := pager.Header().TextEncoding; enc == 2 || enc == 3 {
+		pager.Close()
+		return nil, fmt.Errorf("unsupported text encoding %s: only UTF-8 databases can be read", pager.Header().TextEncodingName())
+	}
+	catalog, err := LoadCatalog(pager)
+	if err != nil {
+		pager.Close()
+		return nil, err
+	}
+	return &DB{pager: pager, catalog: catalog}, nil
+}
+
+func (db *DB) Close() error {
+	return db.pager.Close()
+}
+
+// Info returns the figures the sqlite3 shell reports for .dbinfo.
+func (db *DB) Info() DBInfo {
+	return dbInfo(db.pager, db.catalog)
+}
+
+// TableNames returns the names of the tables and views in the schema, sorted.
+func (db *DB) TableNames() []string {
+	return tableNames(db.catalog)
+}
+
+// Query runs a SELECT statement. args are bound to its parameters by number, so
+// "?1", the first "?" and the first named parameter all take args[0].
+func (db *DB) Query(sql string, args ...any) (*Rows, error) {
+	stmt, params, err := parseStatement(sql)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]Value, len(args))
+	for i, arg := range args {
+		if values[i], err = valueOf(arg); err != nil {
+			return nil, fmt.Errorf("failed to bind argument %d: %w", i+1, err)
+		}
+	}
+	if err := bindParams(params, values); err != nil {
+		return nil, err
+	}
+	q, err := readDataFromSelect(db.pager, db.catalog, stmt.(*SelectStmt))
+	if err != nil {
+		return nil, err
+	}
+	return &Rows{columns: q.columns, src: q.rows}, nil
+}
+
+// bindParams sets the value of every parameter from values, which must hold
+// exactly one value per parameter number.
+func bindParams(params []*Param, values []Value) error {
+	count := 0
+	for _, param := range params {
+		count = max(count, param.Index)
+	}
+	if len(values) != count {
+		return fmt.Errorf("expected %d arguments, got %d", count, len(values))
+	}
+	for _, param := range params {
+		param.Value = values[param.Index-1]
+	}
+	return nil
+}
+
+// valueOf converts a Go value to the SQLite value it is bound as.
+func valueOf(arg any) (Value, error) {
+	switch v := arg.(type) {
+	case nil:
+		return NullValue(), nil
+	case Value:
+		return v, nil
+	case int:
+		return IntegerValue(int64(v)), nil
+	case int8:
+		return IntegerValue(int64(v)), nil
+	case int16:
+		return IntegerValue(int64(v)), nil
+	case int32:
+		return IntegerValue(int64(v)), nil
+	case int64:
+		return IntegerValue(v), nil
+	case uint:
+		return valueOf(uint64(v))
+	case uint8:
+		return IntegerValue(int64(v)), nil
+	case uint16:
+		return IntegerValue(int64(v)), nil
+	case uint32:
+		return IntegerValue(int64(v)), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return Value{}, fmt.Errorf("uint64 %d overflows a 64-bit integer", v)
+		}
+		return IntegerValue(int64(v)), nil
+	case float32:
+		return RealValue(float64(v)), nil
+	case float64:
+		return RealValue(v), nil
+	case bool:
+		if v {
+			return IntegerValue(1), nil
+		}
+		return IntegerValue(0), nil
+	case string:
+		return TextValue(v), nil
+	case []byte:
+		if v == nil {
+			return NullValue(), nil
+		}
+		return BlobValue(v), nil
+	case time.Time:
+		return TextValue(v.Format(timeFormat)), nil
+	}
+	return Value{}, fmt.Errorf("unsupported type %T", arg)
+}
@@ -0,0 +1,69 @@
+package sqlitego
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+type DBInfo struct {
+	Header       FileHeader
+	TableCount   int
+	IndexCount   int
+	TriggerCount int
+	ViewCount    int
+	SchemaSize   int // total length of the sql column of sqlite_schema, in characters
+}
+
+func dbInfo(pager *Pager, catalog *Catalog) DBInfo {
+	info := DBInfo{Header: pager.Header()}
+
+	for _, entry := range catalog.Entries {
+		switch entry.Type {
+		case "table":
+			info.TableCount++
+		case "index":
+			info.IndexCount++
+		case "trigger":
+			info.TriggerCount++
+		case "view":
+			info.ViewCount++
+		}
+		info.SchemaSize += utf8.RuneCountInString(entry.SQL)
+	}
+	return info
+}
+
+// Lines renders the report in the layout of the sqlite3 shell's .dbinfo command.
+func (info DBInfo) Lines() []string {
+	fH := info.Header
+	field := func(name string, value any) string {
+		return fmt.Sprintf("%-20s %v", name, value)
+	}
+	encoding := fmt.Sprint(fH.TextEncoding)
+	if name := fH.TextEncodingName(); name != "" {
+		encoding += " (" + name + ")"
+	}
+	return []string{
+		field("database page size:", fH.PageSize),
+		field("write format:", fH.WriteVersion),
+		field("read format:", fH.ReadVersion),
+		field("reserved bytes:", fH.ReservedBytes),
+		field("file change counter:", fH.FileChangeCounter),
+		field("database page count:", fH.PageCount),
+		field("freelist page count:", fH.FreelistCount),
+		field("schema cookie:", fH.SchemaCookie),
+		field("schema format:", fH.SchemaFormat),
+		field("default cache size:", fH.DefaultCacheSize),
+		field("autovacuum top root:", fH.AutoVacuumTopRoot),
+		field("incremental vacuum:", fH.IncrementalVacuum),
+		field("text encoding:", encoding),
+		field("user version:", fH.UserVersion),
+		field("application id:", fH.ApplicationID),
+		field("software version:", fH.SQLiteVersionNumber),
+		field("number of tables:", info.TableCount),
+		field("number of indexes:", info.IndexCount),
+		field("number of triggers:", info.TriggerCount),
+		field("number of views:", info.ViewCount),
+		field("schema size:", info.SchemaSize),
+	}
+}
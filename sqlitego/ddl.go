@@ -0,0 +1,757 @@
+package sqlitego
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TableDef is the parsed form of a CREATE TABLE statement.
+type TableDef struct {
+	Name         string
+	Columns      []ColumnDef
+	Constraints  []TableConstraint
+	WithoutRowid bool
+	Strict       bool
+	RowidAlias   int // index of the column that aliases the rowid, or -1
+	// AutoIndexes holds the keys of the indexes SQLite creates for PRIMARY KEY and
+	// UNIQUE constraints; entry i belongs to sqlite_autoindex_<table>_<i+1>. The
+	// entry of a WITHOUT ROWID table's primary key is the table itself.
+	AutoIndexes [][]IndexedColumn
+}
+
+type ColumnDef struct {
+	Name            string
+	DeclType        string
+	Affinity        Affinity
+	NotNull         bool
+	Default         string // source text of the DEFAULT value, empty when there is none
+	Collate         string
+	PrimaryKey      bool
+	PKDesc          bool
+	AutoIncrement   bool
+	Unique          bool
+	Checks          []string // source text of each CHECK expression
+	References      *ForeignKey
+	Generated       string // source text of a GENERATED ALWAYS AS expression
+	GeneratedStored bool
+
+	// defaultValue is Default evaluated once, for rows written before the column
+	// was added.
+	defaultValue Value
+}
+
+type ForeignKey struct {
+	Table   string
+	Columns []string
+	Actions string // ON DELETE/UPDATE, MATCH and DEFERRABLE clauses, as written
+}
+
+type TableConstraint struct {
+	Name          string
+	Kind          string // "PRIMARY KEY", "UNIQUE", "CHECK" or "FOREIGN KEY"
+	Columns       []IndexedColumn
+	AutoIncrement bool
+	Check         string
+	References    *ForeignKey
+}
+
+// IndexedColumn is one term of a PRIMARY KEY, UNIQUE or CREATE INDEX column list.
+// Expr is set instead of Name for expression terms.
+type IndexedColumn struct {
+	Name    string
+	Expr    string
+	Collate string
+	Desc    bool
+}
+
+// Keywords that end a column's type name.
+// IndexDef is the parsed form of a CREATE INDEX statement, or the key of an
+// automatic index.
+type IndexDef struct {
+	Name    string
+	Table   string
+	Unique  bool
+	Columns []IndexedColumn
+	Where   string // source text of a partial index's WHERE clause
+}
+
+// ViewDef is the parsed form of a CREATE VIEW statement.
+type ViewDef struct {
+	Name    string
+	Columns []string // the column list; empty when the view has none
+	Select  *SelectStmt
+}
+
+var columnConstraintStart = map[string]bool{
+	"CONSTRAINT": true, "PRIMARY": true, "NOT": true, "NULL": true, "UNIQUE": true, "CHECK": true,
+	"DEFAULT": true, "COLLATE": true, "REFERENCES": true, "GENERATED": true, "AS": true,
+}
+
+var tableConstraintStart = map[string]bool{
+	"CONSTRAINT": true, "PRIMARY": true, "UNIQUE": true, "CHECK": true, "FOREIGN": true,
+}
+
+func parseCreateTable(sql string) (*TableDef, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("CREATE"); err != nil {
+		return nil, err
+	}
+	if !p.acceptKeyword("TEMP") {
+		p.acceptKeyword("TEMPORARY")
+	}
+	if p.acceptKeyword("VIRTUAL") {
+		return nil, p.errorf(p.peek(), "virtual tables are not supported")
+	}
+	if err := p.expectKeyword("TABLE"); err != nil {
+		return nil, err
+	}
+	p.acceptKeyword("IF", "NOT", "EXISTS")
+
+	def := &TableDef{RowidAlias: -1}
+	if def.Name, err = p.qualifiedName("table name"); err != nil {
+		return nil, err
+	}
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	for {
+		if tok := p.peek(); tok.kind == tokIdent && tok.quote == 0 && tableConstraintStart[strings.ToUpper(tok.text)] {
+			break
+		}
+		col, err := p.columnDef()
+		if err != nil {
+			return nil, err
+		}
+		def.Columns = append(def.Columns, col)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	if !p.atOp(")") {
+		for {
+			constraint, err := p.tableConstraint()
+			if err != nil {
+				return nil, err
+			}
+			def.Constraints = append(def.Constraints, constraint)
+			// The comma between table constraints is optional in SQLite.
+			p.acceptOp(",")
+			if p.atOp(")") {
+				break
+			}
+		}
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind != tokEOF && !p.atOp(";") {
+		switch {
+		case p.acceptKeyword("WITHOUT"):
+			tok := p.next()
+			if !isKeyword(tok, "ROWID") {
+				return nil, p.errorf(tok, "expected ROWID")
+			}
+			def.WithoutRowid = true
+		case p.acceptKeyword("STRICT"):
+			def.Strict = true
+		default:
+			return nil, p.errorf(p.peek(), "expected WITHOUT ROWID or STRICT")
+		}
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	p.acceptOp(";")
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected text after CREATE TABLE")
+	}
+
+	if len(def.Columns) == 0 {
+		return nil, fmt.Errorf("table %s has no columns", def.Name)
+	}
+	if err := def.resolveConstraints(); err != nil {
+		return nil, err
+	}
+	for i := range def.Columns {
+		def.Columns[i].defaultValue = defaultConstant(def.Columns[i])
+	}
+	return def, nil
+}
+
+// defaultConstant evaluates the DEFAULT of col and applies the column's
+// affinity. ALTER TABLE ADD COLUMN only accepts constant defaults, so one that
+// is not constant, such as CURRENT_TIMESTAMP, is never read this way and gives
+// NULL.
+func defaultConstant(col ColumnDef) Value {
+	if col.Default == "" {
+		return NullValue()
+	}
+	p, err := newParser(col.Default)
+	if err != nil {
+		return NullValue()
+	}
+	expr, err := p.expr()
+	if err != nil || p.peek().kind != tokEOF {
+		return NullValue()
+	}
+	compiled, err := compileExpr(expr, &scope{})
+	if err != nil {
+		return NullValue()
+	}
+	v, err := compiled.eval(nil)
+	if err != nil {
+		return NullValue()
+	}
+	return v.applyAffinity(col.Affinity)
+}
+
+func parseCreateIndex(sql string) (*IndexDef, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("CREATE"); err != nil {
+		return nil, err
+	}
+	def := &IndexDef{Unique: p.acceptKeyword("UNIQUE")}
+	if err := p.expectKeyword("INDEX"); err != nil {
+		return nil, err
+	}
+	p.acceptKeyword("IF", "NOT", "EXISTS")
+	if def.Name, err = p.qualifiedName("index name"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("ON"); err != nil {
+		return nil, err
+	}
+	if def.Table, err = p.identifier("table name", nil); err != nil {
+		return nil, err
+	}
+	if def.Columns, err = p.indexedColumns(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("WHERE") {
+		start, startIdx := p.peek(), p.pos
+		for p.peek().kind != tokEOF && !p.atOp(";") {
+			p.next()
+		}
+		if p.pos == startIdx {
+			return nil, p.errorf(start, "expected an expression")
+		}
+		def.Where = p.textFrom(start)
+	}
+	p.acceptOp(";")
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected text after CREATE INDEX")
+	}
+	return def, nil
+}
+
+func parseCreateView(sql string) (*ViewDef, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("CREATE"); err != nil {
+		return nil, err
+	}
+	if !p.acceptKeyword("TEMP") {
+		p.acceptKeyword("TEMPORARY")
+	}
+	if err := p.expectKeyword("VIEW"); err != nil {
+		return nil, err
+	}
+	p.acceptKeyword("IF", "NOT", "EXISTS")
+	def := &ViewDef{}
+	if def.Name, err = p.qualifiedName("view name"); err != nil {
+		return nil, err
+	}
+	if p.atOp("(") {
+		if def.Columns, err = p.nameList(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+	if def.Select, err = p.selectStmt(); err != nil {
+		return nil, err
+	}
+	p.acceptOp(";")
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected text after CREATE VIEW")
+	}
+	return def, nil
+}
+
+// qualifiedName reads "name" or "schema.name" and returns name.
+func (p *parser) qualifiedName(what string) (string, error) {
+	name, err := p.identifier(what, nil)
+	if err != nil {
+		return "", err
+	}
+	if p.acceptOp(".") {
+		return p.identifier(what, nil)
+	}
+	return name, nil
+}
+
+// typeName reads a type name: any run of words that are not in stop, optionally
+// followed by "(n)" or "(n, m)". It may be empty.
+func (p *parser) typeName(stop map[string]bool) (string, error) {
+	var typeWords []string
+	for {
+		tok := p.peek()
+		if tok.kind != tokIdent || (tok.quote == 0 && stop[strings.ToUpper(tok.text)]) {
+			break
+		}
+		typeWords = append(typeWords, p.next().text)
+	}
+	if len(typeWords) > 0 && p.atOp("(") {
+		size, err := p.skipParenthesized()
+		if err != nil {
+			return "", err
+		}
+		typeWords[len(typeWords)-1] += "(" + size + ")"
+	}
+	return strings.Join(typeWords, " "), nil
+}
+
+func (p *parser) columnDef() (ColumnDef, error) {
+	var col ColumnDef
+	var err error
+	if col.Name, err = p.identifier("column name", nil); err != nil {
+		return col, err
+	}
+
+	if col.DeclType, err = p.typeName(columnConstraintStart); err != nil {
+		return col, err
+	}
+	col.Affinity = affinityFromDeclType(col.DeclType)
+
+	for {
+		if p.acceptKeyword("CONSTRAINT") {
+			if _, err := p.identifier("constraint name", nil); err != nil {
+				return col, err
+			}
+		}
+		switch {
+		case p.acceptKeyword("PRIMARY"):
+			if err := p.expectKeyword("KEY"); err != nil {
+				return col, err
+			}
+			col.PrimaryKey = true
+			if p.acceptKeyword("DESC") {
+				col.PKDesc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			if err := p.conflictClause(); err != nil {
+				return col, err
+			}
+			col.AutoIncrement = p.acceptKeyword("AUTOINCREMENT")
+		case p.acceptKeyword("NOT"):
+			if err := p.expectKeyword("NULL"); err != nil {
+				return col, err
+			}
+			col.NotNull = true
+			if err := p.conflictClause(); err != nil {
+				return col, err
+			}
+		case p.acceptKeyword("NULL"):
+			if err := p.conflictClause(); err != nil {
+				return col, err
+			}
+		case p.acceptKeyword("UNIQUE"):
+			col.Unique = true
+			if err := p.conflictClause(); err != nil {
+				return col, err
+			}
+		case p.acceptKeyword("CHECK"):
+			check, err := p.skipParenthesized()
+			if err != nil {
+				return col, err
+			}
+			col.Checks = append(col.Checks, check)
+		case p.acceptKeyword("DEFAULT"):
+			if col.Default, err = p.defaultValue(); err != nil {
+				return col, err
+			}
+		case p.acceptKeyword("COLLATE"):
+			if col.Collate, err = p.identifier("collation name", nil); err != nil {
+				return col, err
+			}
+		case p.atKeyword("REFERENCES"):
+			if col.References, err = p.foreignKeyClause(); err != nil {
+				return col, err
+			}
+		case p.atKeyword("GENERATED") || p.atKeyword("AS"):
+			if p.acceptKeyword("GENERATED") {
+				if err := p.expectKeyword("ALWAYS"); err != nil {
+					return col, err
+				}
+			}
+			if err := p.expectKeyword("AS"); err != nil {
+				return col, err
+			}
+			if col.Generated, err = p.skipParenthesized(); err != nil {
+				return col, err
+			}
+			if p.acceptKeyword("STORED") {
+				col.GeneratedStored = true
+			} else {
+				p.acceptKeyword("VIRTUAL")
+			}
+		default:
+			if tok := p.peek(); !(tok.kind == tokOp && (tok.text == "," || tok.text == ")")) {
+				return col, p.errorf(tok, "unexpected token in definition of column "+col.Name)
+			}
+			return col, nil
+		}
+	}
+}
+
+// defaultValue reads the operand of DEFAULT: a literal, a signed number, a bare
+// identifier or a parenthesized expression.
+func (p *parser) defaultValue() (string, error) {
+	if p.atOp("(") {
+		start := p.peek().pos
+		if _, err := p.skipParenthesized(); err != nil {
+			return "", err
+		}
+		return p.sql[start:p.toks[p.pos-1].end], nil
+	}
+	start := p.peek().pos
+	if p.atOp("+") || p.atOp("-") {
+		p.next()
+	}
+	tok := p.next()
+	switch tok.kind {
+	case tokString, tokNumber, tokBlob, tokIdent:
+		return p.sql[start:tok.end], nil
+	}
+	return "", p.errorf(tok, "expected a default value")
+}
+
+func (p *parser) conflictClause() error {
+	if !p.acceptKeyword("ON", "CONFLICT") {
+		return nil
+	}
+	tok := p.next()
+	for _, action := range []string{"ROLLBACK", "ABORT", "FAIL", "IGNORE", "REPLACE"} {
+		if isKeyword(tok, action) {
+			return nil
+		}
+	}
+	return p.errorf(tok, "expected a conflict resolution")
+}
+
+func (p *parser) foreignKeyClause() (*ForeignKey, error) {
+	if err := p.expectKeyword("REFERENCES"); err != nil {
+		return nil, err
+	}
+	fk := &ForeignKey{}
+	var err error
+	if fk.Table, err = p.identifier("table name", nil); err != nil {
+		return nil, err
+	}
+	if p.atOp("(") {
+		if fk.Columns, err = p.nameList(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Keep the trailing actions verbatim; nothing here enforces them.
+	start := p.peek().pos
+	end := start
+	for {
+		switch {
+		case p.acceptKeyword("ON"):
+			if !p.acceptKeyword("DELETE") && !p.acceptKeyword("UPDATE") {
+				return nil, p.errorf(p.peek(), "expected DELETE or UPDATE")
+			}
+			switch {
+			case p.acceptKeyword("SET", "NULL"), p.acceptKeyword("SET", "DEFAULT"), p.acceptKeyword("CASCADE"),
+				p.acceptKeyword("RESTRICT"), p.acceptKeyword("NO", "ACTION"):
+			default:
+				return nil, p.errorf(p.peek(), "expected a foreign key action")
+			}
+		case p.acceptKeyword("MATCH"):
+			if _, err := p.identifier("match type", nil); err != nil {
+				return nil, err
+			}
+		case p.atKeyword("NOT", "DEFERRABLE") || p.atKeyword("DEFERRABLE"):
+			p.acceptKeyword("NOT")
+			p.next()
+			if p.acceptKeyword("INITIALLY") && !p.acceptKeyword("DEFERRED") && !p.acceptKeyword("IMMEDIATE") {
+				return nil, p.errorf(p.peek(), "expected DEFERRED or IMMEDIATE")
+			}
+		default:
+			fk.Actions = strings.TrimSpace(p.sql[start:end])
+			return fk, nil
+		}
+		end = p.toks[p.pos-1].end
+	}
+}
+
+// nameList reads "(name, name, ...)".
+func (p *parser) nameList() ([]string, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.identifier("column name", nil)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	return names, p.expectOp(")")
+}
+
+// indexedColumns reads "(term [COLLATE name] [ASC|DESC], ...)".
+func (p *parser) indexedColumns() ([]IndexedColumn, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	cols, err := p.indexedColumnTerms()
+	if err != nil {
+		return nil, err
+	}
+	return cols, p.expectOp(")")
+}
+
+// indexedColumnTerms reads a comma-separated list of indexed columns. A term that
+// is a lone identifier is a column; anything else is kept as expression text.
+func (p *parser) indexedColumnTerms() ([]IndexedColumn, error) {
+	var cols []IndexedColumn
+	for {
+		var col IndexedColumn
+		after := p.peekAt(1)
+		if p.peek().kind == tokIdent && (after.kind == tokOp && (after.text == "," || after.text == ")") ||
+			isKeyword(after, "COLLATE") || isKeyword(after, "ASC") || isKeyword(after, "DESC") || isKeyword(after, "AUTOINCREMENT")) {
+			col.Name = p.next().text
+		} else {
+			expr, err := p.skipExpression()
+			if err != nil {
+				return nil, err
+			}
+			col.Expr = expr
+		}
+		if p.acceptKeyword("COLLATE") {
+			var err error
+			if col.Collate, err = p.identifier("collation name", nil); err != nil {
+				return nil, err
+			}
+		}
+		if p.acceptKeyword("DESC") {
+			col.Desc = true
+		} else {
+			p.acceptKeyword("ASC")
+		}
+		cols = append(cols, col)
+		if !p.acceptOp(",") {
+			return cols, nil
+		}
+	}
+}
+
+// skipExpression consumes tokens up to the next top-level ",", ")", COLLATE, ASC
+// or DESC and returns their source text.
+func (p *parser) skipExpression() (string, error) {
+	start := p.peek()
+	depth := 0
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == tokEOF:
+			return "", p.errorf(start, "unterminated expression")
+		case tok.kind == tokOp && tok.text == "(":
+			depth++
+		case tok.kind == tokOp && tok.text == ")":
+			if depth == 0 {
+				return p.sqlBetween(start, tok), nil
+			}
+			depth--
+		case depth == 0 && (tok.kind == tokOp && tok.text == "," || isKeyword(tok, "COLLATE") || isKeyword(tok, "ASC") || isKeyword(tok, "DESC")):
+			return p.sqlBetween(start, tok), nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) sqlBetween(from, to token) string {
+	return strings.TrimSpace(p.sql[from.pos:to.pos])
+}
+
+func (p *parser) tableConstraint() (TableConstraint, error) {
+	var c TableConstraint
+	var err error
+	if p.acceptKeyword("CONSTRAINT") {
+		if c.Name, err = p.identifier("constraint name", nil); err != nil {
+			return c, err
+		}
+	}
+	switch {
+	case p.acceptKeyword("PRIMARY"):
+		if err := p.expectKeyword("KEY"); err != nil {
+			return c, err
+		}
+		c.Kind = "PRIMARY KEY"
+		if err := p.expectOp("("); err != nil {
+			return c, err
+		}
+		if c.Columns, err = p.indexedColumnTerms(); err != nil {
+			return c, err
+		}
+		c.AutoIncrement = p.acceptKeyword("AUTOINCREMENT")
+		if err := p.expectOp(")"); err != nil {
+			return c, err
+		}
+		return c, p.conflictClause()
+	case p.acceptKeyword("UNIQUE"):
+		c.Kind = "UNIQUE"
+		if c.Columns, err = p.indexedColumns(); err != nil {
+			return c, err
+		}
+		return c, p.conflictClause()
+	case p.acceptKeyword("CHECK"):
+		c.Kind = "CHECK"
+		c.Check, err = p.skipParenthesized()
+		return c, err
+	case p.acceptKeyword("FOREIGN"):
+		if err := p.expectKeyword("KEY"); err != nil {
+			return c, err
+		}
+		c.Kind = "FOREIGN KEY"
+		names, err := p.nameList()
+		if err != nil {
+			return c, err
+		}
+		for _, name := range names {
+			c.Columns = append(c.Columns, IndexedColumn{Name: name})
+		}
+		c.References, err = p.foreignKeyClause()
+		return c, err
+	}
+	return c, p.errorf(p.peek(), "expected a column definition or table constraint")
+}
+
+// resolveConstraints folds table constraints into the column definitions and
+// works out whether a column aliases the rowid.
+func (def *TableDef) resolveConstraints() error {
+	var pk []int // columns making up the primary key
+	pkDesc := false
+	var keys [][]IndexedColumn // PRIMARY KEY and UNIQUE keys in the order they are written
+	pkKey := -1
+	for i, col := range def.Columns {
+		if col.PrimaryKey {
+			pk = append(pk, i)
+			pkDesc = col.PKDesc
+			pkKey = len(keys)
+			keys = append(keys, []IndexedColumn{{Name: col.Name, Desc: col.PKDesc}})
+		}
+		if col.Unique {
+			keys = append(keys, []IndexedColumn{{Name: col.Name}})
+		}
+	}
+	pkFromColumn := len(pk) > 0
+
+	for _, c := range def.Constraints {
+		switch c.Kind {
+		case "PRIMARY KEY":
+			if len(pk) > 0 {
+				return fmt.Errorf("table %s has more than one primary key", def.Name)
+			}
+			for _, ic := range c.Columns {
+				idx := def.ColumnIndex(ic.Name)
+				if idx == -1 {
+					return fmt.Errorf("table %s has no column named %s", def.Name, ic.Name)
+				}
+				def.Columns[idx].PrimaryKey = true
+				def.Columns[idx].AutoIncrement = c.AutoIncrement
+				pk = append(pk, idx)
+			}
+			pkKey = len(keys)
+			keys = append(keys, c.Columns)
+		case "UNIQUE":
+			keys = append(keys, c.Columns)
+			if len(c.Columns) == 1 && c.Columns[0].Name != "" {
+				if idx := def.ColumnIndex(c.Columns[0].Name); idx != -1 {
+					def.Columns[idx].Unique = true
+				}
+			}
+		}
+	}
+	if len(pk) > 1 && pkFromColumn {
+		return fmt.Errorf("table %s has more than one primary key", def.Name)
+	}
+
+	// Only a lone column declared exactly INTEGER aliases the rowid. The column
+	// constraint form "INTEGER PRIMARY KEY DESC" is a historical exception that
+	// does not, while a DESC table constraint does.
+	if !def.WithoutRowid && len(pk) == 1 && !(pkFromColumn && pkDesc) &&
+		strings.EqualFold(def.Columns[pk[0]].DeclType, "INTEGER") {
+		def.RowidAlias = pk[0]
+	}
+
+	for i, key := range keys {
+		if i == pkKey && def.RowidAlias >= 0 {
+			continue
+		}
+		// A constraint repeating an earlier key reuses its index.
+		if !slices.ContainsFunc(def.AutoIndexes, func(k []IndexedColumn) bool { return sameIndexKey(k, key) }) {
+			def.AutoIndexes = append(def.AutoIndexes, key)
+		}
+	}
+	return nil
+}
+
+func sameIndexKey(a, b []IndexedColumn) bool {
+	return slices.EqualFunc(a, b, func(x, y IndexedColumn) bool {
+		return strings.EqualFold(x.Name, y.Name) && x.Expr == y.Expr && strings.EqualFold(x.Collate, y.Collate)
+	})
+}
+
+// ColumnIndex returns the position of the named column, or -1.
+func (def *TableDef) ColumnIndex(name string) int {
+	for i, col := range def.Columns {
+		if strings.EqualFold(col.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isRowid reports whether position idx of a table row holds the rowid: the
+// rowid alias, or the rowid that follows the columns.
+func (def *TableDef) isRowid(idx int) bool {
+	return idx == def.RowidAlias || idx == len(def.Columns)
+}
+
+// columnValue returns column idx of a stored row. The rowid alias is read from the
+// cell's rowid, columns added by ALTER TABLE after the row was written take their
+// default, and REAL columns get back the fractional part SQLite drops on disk.
+func (def *TableDef) columnValue(rec Record, rowid int64, idx int) Value {
+	if idx == def.RowidAlias {
+		return IntegerValue(rowid)
+	}
+	col := def.Columns[idx]
+	if idx >= len(rec.Values) {
+		return col.defaultValue
+	}
+	v := rec.Values[idx]
+	if col.Affinity == AffinityReal && v.Type == TypeInteger {
+		return RealValue(float64(v.Int))
+	}
+	return v
+}
@@ -0,0 +1,175 @@
+package sqlitego
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DriverName is the name the package registers with database/sql, so that
+// sql.Open(DriverName, "file.db") reads file.db through this package.
+const DriverName = "sqlitego"
+
+func init() {
+	sql.Register(DriverName, &Driver{})
+}
+
+var errReadOnly = errors.New("the database is opened read-only")
+
+// Driver implements driver.Driver. The data source name is the path of the
+// database file.
+type Driver struct{}
+
+func (*Driver) Open(name string) (driver.Conn, error) {
+	db, err := Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{db: db}, nil
+}
+
+// conn is one database/sql connection. database/sql never uses a connection from
+// two goroutines at once, which is all a DB needs.
+type conn struct {
+	db *DB
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	parsed, params, err := parseStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	numInput := 0
+	for _, param := range params {
+		numInput = max(numInput, param.Index)
+	}
+	return &stmt{conn: c, parsed: parsed.(*SelectStmt), params: params, numInput: numInput}, nil
+}
+
+func (c *conn) Close() error {
+	return c.db.Close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported: %w", errReadOnly)
+}
+
+type stmt struct {
+	conn     *conn
+	parsed   *SelectStmt
+	params   []*Param
+	numInput int
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return s.numInput
+}
+
+// Exec runs the statement and discards its rows: a SELECT changes nothing.
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	rows, err := s.Query(args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, len(rows.Columns()))
+	for {
+		if err := rows.Next(dest); err == io.EOF {
+			return driver.RowsAffected(0), nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return s.QueryContext(context.Background(), named)
+}
+
+// QueryContext binds args by name when database/sql was given sql.Named values,
+// and by position otherwise.
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	values := make([]Value, s.numInput)
+	for _, arg := range args {
+		v, err := valueOf(arg.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to bind argument %d: %w", arg.Ordinal, err)
+		}
+		index := arg.Ordinal
+		if arg.Name != "" {
+			if index = s.paramIndex(arg.Name); index == 0 {
+				return nil, fmt.Errorf("no parameter named %s", arg.Name)
+			}
+		}
+		if index < 1 || index > len(values) {
+			return nil, fmt.Errorf("expected %d arguments, got %d", s.numInput, len(args))
+		}
+		values[index-1] = v
+	}
+	if err := bindParams(s.params, values); err != nil {
+		return nil, err
+	}
+	q, err := readDataFromSelect(s.conn.db.pager, s.conn.db.catalog, s.parsed)
+	if err != nil {
+		return nil, err
+	}
+	return &driverRows{ctx: ctx, rows: &Rows{columns: q.columns, src: q.rows}}, nil
+}
+
+// paramIndex returns the number of the parameter written as ":name", "@name" or
+// "$name", or 0 when there is none.
+func (s *stmt) paramIndex(name string) int {
+	for _, param := range s.params {
+		if param.Name != "" && strings.ContainsRune(":@$", rune(param.Name[0])) && param.Name[1:] == name {
+			return param.Index
+		}
+	}
+	return 0
+}
+
+type driverRows struct {
+	ctx  context.Context
+	rows *Rows
+}
+
+func (r *driverRows) Columns() []string {
+	return r.rows.Columns()
+}
+
+func (r *driverRows) Close() error {
+	return r.rows.Close()
+}
+
+func (r *driverRows) Next(dest []driver.Value) error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	for i, v := range r.rows.Values() {
+		dest[i] = goValue(v)
+	}
+	return nil
+}
+
+// ColumnTypeDatabaseTypeName returns the declared type of a result column that
+// reads a table column, upper-cased, and "" for expressions.
+func (r *driverRows) ColumnTypeDatabaseTypeName(index int) string {
+	return strings.ToUpper(r.rows.columns[index].DeclType)
+}
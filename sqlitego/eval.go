@@ -0,0 +1,655 @@
+package sqlitego
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Row holds the values of the current row, one per column of a scope.
+type Row []Value
+
+// compiledExpr is an expression whose column references have been resolved
+// against a scope, ready to be evaluated once per row.
+type compiledExpr struct {
+	eval      func(row Row) (Value, error)
+	affinity  Affinity
+	collation Collation // a column's collation, BINARY unless declared; nil for most expressions
+	// explicit marks a collation given by a COLLATE operator, which takes
+	// precedence over the collation of a column in comparisons.
+	explicit bool
+	// truth marks the TRUE and FALSE keywords, which "x IS TRUE" reads as a
+	// truth test rather than a comparison with 1.
+	truth bool
+}
+
+// scopeColumn describes one position of the rows a scope evaluates.
+type scopeColumn struct {
+	Table     string // name or alias of the table the column comes from
+	Name      string
+	DeclType  string
+	Affinity  Affinity
+	Collation Collation
+	// Using marks a column that a USING or NATURAL join matched with a column of
+	// an earlier table. "*" and unqualified names take that column instead.
+	Using bool
+	// Hidden marks the rowid that follows the columns of every table, which "*"
+	// leaves out. Rowid marks the column that rowid, oid and _rowid_ name when no
+	// column of the table takes the name: the rowid alias, or else the hidden
+	// rowid.
+	Hidden, Rowid bool
+}
+
+// scope lists the columns an expression may refer to.
+type scope struct {
+	columns []scopeColumn
+	// aliases maps the aliases of the SELECT list to their expressions, for the
+	// clauses where SQLite lets a name that matches no column refer to one.
+	aliases map[string]Expr
+	// aggregates, when set, collects aggregate calls instead of rejecting them.
+	aggregates *aggregateContext
+	// windows, when set, collects window function calls instead of rejecting
+	// them.
+	windows *windowContext
+	// reads, when set, records the position of every column compiled.
+	reads map[int]bool
+	// query, when set, lets the expressions hold subqueries and, inside one,
+	// refer to the columns of the queries around it.
+	query *queryContext
+}
+
+// newTableScope builds the scope of a single table, referred to as name.
+func newTableScope(name string, def *TableDef) (*scope, error) {
+	s := &scope{}
+	for i, col := range def.Columns {
+		sc := scopeColumn{Table: name, Name: col.Name, DeclType: col.DeclType, Affinity: col.Affinity, Collation: binaryCollation}
+		if col.Collate != "" {
+			coll, ok := lookupCollation(col.Collate)
+			if !ok {
+				return nil, fmt.Errorf("no such collation sequence: %s", col.Collate)
+			}
+			sc.Collation = coll
+		}
+		sc.Rowid = i == def.RowidAlias
+		s.columns = append(s.columns, sc)
+	}
+	s.columns = append(s.columns, scopeColumn{Table: name, Name: "rowid", DeclType: "INTEGER", Affinity: AffinityInteger, Hidden: true, Rowid: def.RowidAlias < 0})
+	return s, nil
+}
+
+// resolve returns the row position of ref, or -1 when no column matches.
+func (s *scope) resolve(ref *ColumnRef) (int, error) {
+	if ref.position > 0 {
+		return ref.position - 1, nil
+	}
+	found, err := s.match(ref, func(col scopeColumn) bool {
+		return !col.Hidden && strings.EqualFold(col.Name, ref.Column)
+	})
+	if found >= 0 || err != nil || !isRowidName(ref.Column) {
+		return found, err
+	}
+	return s.match(ref, func(col scopeColumn) bool { return col.Rowid })
+}
+
+// match returns the position of the only column of ref's table, or of any
+// table when ref is unqualified, that is accepted by ok.
+func (s *scope) match(ref *ColumnRef, ok func(col scopeColumn) bool) (int, error) {
+	found := -1
+	for i, col := range s.columns {
+		if !ok(col) {
+			continue
+		}
+		if ref.Table == "" && col.Using || ref.Table != "" && !strings.EqualFold(col.Table, ref.Table) {
+			continue
+		}
+		if found >= 0 {
+			return -1, fmt.Errorf("ambiguous column name: %s", refName(ref))
+		}
+		found = i
+	}
+	return found, nil
+}
+
+func isRowidName(name string) bool {
+	return strings.EqualFold(name, "rowid") || strings.EqualFold(name, "oid") || strings.EqualFold(name, "_rowid_")
+}
+
+func refName(ref *ColumnRef) string {
+	if ref.Table != "" {
+		return ref.Table + "." + ref.Column
+	}
+	return ref.Column
+}
+
+func constExpr(v Value) *compiledExpr {
+	return &compiledExpr{eval: func(Row) (Value, error) { return v, nil }}
+}
+
+func compileExpr(expr Expr, s *scope) (*compiledExpr, error) {
+	switch e := expr.(type) {
+	case *Literal:
+		return constExpr(e.Value), nil
+	case *Param:
+		return constExpr(e.Value), nil
+	case *ColumnRef:
+		return compileColumnRef(e, s)
+	case *UnaryExpr:
+		return compileUnary(e, s)
+	case *BinaryExpr:
+		return compileBinary(e, s)
+	case *BetweenExpr:
+		return compileBetween(e, s)
+	case *CollateExpr:
+		inner, err := compileExpr(e.Expr, s)
+		if err != nil {
+			return nil, err
+		}
+		coll, ok := lookupCollation(e.Collation)
+		if !ok {
+			return nil, fmt.Errorf("no such collation sequence: %s", e.Collation)
+		}
+		return &compiledExpr{eval: inner.eval, affinity: inner.affinity, collation: coll, explicit: true}, nil
+	case *InExpr:
+		return compileIn(e, s)
+	case *SubqueryExpr:
+		return compileScalarSubquery(e, s)
+	case *ExistsExpr:
+		return compileExists(e, s)
+	case *LikeExpr:
+		return compileLike(e, s)
+	case *CaseExpr:
+		return compileCase(e, s)
+	case *CastExpr:
+		inner, err := compileExpr(e.Expr, s)
+		if err != nil {
+			return nil, err
+		}
+		// CAST keeps the collation of its operand.
+		affinity := affinityFromDeclType(e.Type)
+		return &compiledExpr{eval: func(row Row) (Value, error) {
+			v, err := inner.eval(row)
+			if err != nil {
+				return v, err
+			}
+			return castValue(v, affinity), nil
+		}, affinity: affinity, collation: inner.collation, explicit: inner.explicit}, nil
+	case *FuncCall:
+		name := strings.ToLower(e.Name)
+		if _, ok := windowFuncs[name]; ok || e.Over != nil || e.Window != "" {
+			if s.windows == nil || e.Over == nil && e.Window == "" {
+				return nil, fmt.Errorf("misuse of window function %s()", e.Name)
+			}
+			return s.windows.add(e)
+		}
+		// min() and max() with more than one argument are scalar functions.
+		if fn, ok := aggregateFuncs[name]; ok && (len(e.Args) <= 1 || name != "min" && name != "max") {
+			if s.aggregates == nil {
+				return nil, fmt.Errorf("misuse of aggregate function %s()", e.Name)
+			}
+			return s.aggregates.add(e, fn)
+		}
+		return compileFunc(e, s)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", expr)
+}
+
+func compileColumnRef(ref *ColumnRef, s *scope) (*compiledExpr, error) {
+	idx, err := s.resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	if idx >= 0 {
+		if s.reads != nil {
+			s.reads[idx] = true
+		}
+		col := s.columns[idx]
+		return &compiledExpr{
+			eval:      func(row Row) (Value, error) { return row[idx], nil },
+			affinity:  col.Affinity,
+			collation: col.Collation,
+		}, nil
+	}
+	if ref.Table == "" {
+		// Fallbacks SQLite applies to names that match no column.
+		if alias, ok := s.aliases[strings.ToLower(ref.Column)]; ok {
+			inner := *s
+			inner.aliases = nil
+			return compileExpr(alias, &inner)
+		}
+	}
+	outer, err := compileOuterColumn(ref, s)
+	if outer != nil || err != nil {
+		return outer, err
+	}
+	if ref.Table == "" {
+		switch {
+		case ref.DoubleQuoted:
+			return constExpr(TextValue(ref.Column)), nil
+		case strings.EqualFold(ref.Column, "true"), strings.EqualFold(ref.Column, "false"):
+			keyword := constExpr(boolValue(strings.EqualFold(ref.Column, "true")))
+			keyword.truth = true
+			return keyword, nil
+		}
+	}
+	return nil, fmt.Errorf("no such column: %s", refName(ref))
+}
+
+func compileUnary(e *UnaryExpr, s *scope) (*compiledExpr, error) {
+	operand, err := compileExpr(e.Operand, s)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Op {
+	case "+":
+		// Unary plus keeps the value and collation but drops the affinity.
+		return &compiledExpr{eval: operand.eval, collation: operand.collation, explicit: operand.explicit}, nil
+	case "-":
+		return &compiledExpr{eval: func(row Row) (Value, error) {
+			v, err := operand.eval(row)
+			if err != nil {
+				return v, err
+			}
+			return negate(v), nil
+		}}, nil
+	case "~":
+		return &compiledExpr{eval: func(row Row) (Value, error) {
+			v, err := operand.eval(row)
+			if err != nil || v.IsNull() {
+				return v, err
+			}
+			return IntegerValue(^intValue(v)), nil
+		}}, nil
+	case "NOT":
+		return &compiledExpr{eval: func(row Row) (Value, error) {
+			v, err := operand.eval(row)
+			if err != nil {
+				return v, err
+			}
+			truth, known := truthValue(v)
+			if !known {
+				return NullValue(), nil
+			}
+			return boolValue(!truth), nil
+		}}, nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", e.Op)
+}
+
+func compileBinary(e *BinaryExpr, s *scope) (*compiledExpr, error) {
+	left, err := compileExpr(e.Left, s)
+	if err != nil {
+		return nil, err
+	}
+	right, err := compileExpr(e.Right, s)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Op {
+	case "AND", "OR":
+		return compileLogical(e.Op == "AND", left, right), nil
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compileComparison(e.Op, left, right), nil
+	case "IS", "IS NOT":
+		if right.truth {
+			return compileTruth(e.Op == "IS", left, right), nil
+		}
+		return compileIs(e.Op == "IS", left, right), nil
+	case "+", "-", "*", "/", "%":
+		return compileOperator(left, right, func(l, r Value) Value { return arithmetic(e.Op, l, r) }), nil
+	case "&", "|", "<<", ">>":
+		return compileOperator(left, right, func(l, r Value) Value { return bitwise(e.Op, l, r) }), nil
+	case "||":
+		return compileOperator(left, right, func(l, r Value) Value {
+			return TextValue(l.String() + r.String())
+		}), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", e.Op)
+}
+
+// compileOperator applies op to the values of left and right. The result is
+// NULL when either is.
+func compileOperator(left, right *compiledExpr, op func(l, r Value) Value) *compiledExpr {
+	return &compiledExpr{eval: func(row Row) (Value, error) {
+		l, err := left.eval(row)
+		if err != nil {
+			return l, err
+		}
+		r, err := right.eval(row)
+		if err != nil {
+			return r, err
+		}
+		if l.IsNull() || r.IsNull() {
+			return NullValue(), nil
+		}
+		return op(l, r), nil
+	}}
+}
+
+// compileCase evaluates the THEN of the first WHEN that holds: WHEN terms are
+// conditions, or with an operand, values compared with it by "=".
+func compileCase(e *CaseExpr, s *scope) (*compiledExpr, error) {
+	var operand *compiledExpr
+	if e.Operand != nil {
+		var err error
+		if operand, err = compileExpr(e.Operand, s); err != nil {
+			return nil, err
+		}
+	}
+	whens := make([]*compiledExpr, len(e.Whens))
+	thens := make([]*compiledExpr, len(e.Whens))
+	for i, when := range e.Whens {
+		cond, err := compileExpr(when.When, s)
+		if err != nil {
+			return nil, err
+		}
+		if operand != nil {
+			cond = compileComparison("=", operand, cond)
+		}
+		whens[i] = cond
+		if thens[i], err = compileExpr(when.Then, s); err != nil {
+			return nil, err
+		}
+	}
+	otherwise := constExpr(NullValue())
+	if e.Else != nil {
+		var err error
+		if otherwise, err = compileExpr(e.Else, s); err != nil {
+			return nil, err
+		}
+	}
+	return &compiledExpr{eval: func(row Row) (Value, error) {
+		for i, when := range whens {
+			v, err := when.eval(row)
+			if err != nil {
+				return v, err
+			}
+			if truth, _ := truthValue(v); truth {
+				return thens[i].eval(row)
+			}
+		}
+		return otherwise.eval(row)
+	}}, nil
+}
+
+// compileLogical implements AND and OR with SQL's three-valued logic: a NULL
+// operand only matters when the other operand does not decide the result.
+func compileLogical(isAnd bool, left, right *compiledExpr) *compiledExpr {
+	return &compiledExpr{eval: func(row Row) (Value, error) {
+		l, err := left.eval(row)
+		if err != nil {
+			return l, err
+		}
+		lTruth, lKnown := truthValue(l)
+		if lKnown && lTruth != isAnd {
+			return boolValue(lTruth), nil
+		}
+		r, err := right.eval(row)
+		if err != nil {
+			return r, err
+		}
+		rTruth, rKnown := truthValue(r)
+		if rKnown && rTruth != isAnd {
+			return boolValue(rTruth), nil
+		}
+		if !lKnown || !rKnown {
+			return NullValue(), nil
+		}
+		return boolValue(isAnd), nil
+	}}
+}
+
+// compileComparison applies SQLite's comparison affinity rules and the
+// collation of comparisonCollation.
+func compileComparison(op string, left, right *compiledExpr) *compiledExpr {
+	coll := comparisonCollation(left, right)
+	return &compiledExpr{eval: func(row Row) (Value, error) {
+		l, err := left.eval(row)
+		if err != nil {
+			return l, err
+		}
+		r, err := right.eval(row)
+		if err != nil {
+			return r, err
+		}
+		if l.IsNull() || r.IsNull() {
+			return NullValue(), nil
+		}
+		l, r = prepareComparison(l, left.affinity, r, right.affinity)
+		c := CompareValues(l, r, coll)
+		switch op {
+		case "=":
+			return boolValue(c == 0), nil
+		case "!=":
+			return boolValue(c != 0), nil
+		case "<":
+			return boolValue(c < 0), nil
+		case "<=":
+			return boolValue(c <= 0), nil
+		case ">":
+			return boolValue(c > 0), nil
+		}
+		return boolValue(c >= 0), nil
+	}}
+}
+
+// comparisonCollation picks the collation of a binary comparison: an explicit
+// COLLATE on the left, then on the right, then the collation of the left
+// operand, then the right one's. A column always has one, BINARY unless it was
+// declared with COLLATE, so a column on the left decides.
+func comparisonCollation(left, right *compiledExpr) Collation {
+	switch {
+	case left.explicit:
+		return left.collation
+	case right.explicit:
+		return right.collation
+	case left.collation != nil:
+		return left.collation
+	}
+	return right.collation
+}
+
+// compileIs compares like "=", except that NULL IS NULL is true and NULL IS x is
+// false rather than NULL.
+func compileIs(is bool, left, right *compiledExpr) *compiledExpr {
+	eq := compileComparison("=", left, right)
+	return &compiledExpr{eval: func(row Row) (Value, error) {
+		l, err := left.eval(row)
+		if err != nil {
+			return l, err
+		}
+		r, err := right.eval(row)
+		if err != nil {
+			return r, err
+		}
+		if l.IsNull() || r.IsNull() {
+			return boolValue(l.IsNull() == r.IsNull() == is), nil
+		}
+		v, err := eq.eval(row)
+		if err != nil {
+			return v, err
+		}
+		return boolValue((v.Int != 0) == is), nil
+	}}
+}
+
+// compileTruth evaluates "x IS [NOT] TRUE" and "x IS [NOT] FALSE": x IS TRUE
+// holds when x is true, so NULL IS TRUE and NULL IS FALSE are both false.
+func compileTruth(is bool, left, right *compiledExpr) *compiledExpr {
+	return &compiledExpr{eval: func(row Row) (Value, error) {
+		l, err := left.eval(row)
+		if err != nil {
+			return l, err
+		}
+		r, err := right.eval(row)
+		if err != nil {
+			return r, err
+		}
+		truth, known := truthValue(l)
+		return boolValue((known && truth == (r.Int != 0)) == is), nil
+	}}
+}
+
+// compileIn evaluates "x IN (list)" as "x = +a OR x = +b ...": the list items
+// take no affinity, and the result is NULL when nothing matches but x or some
+// item is NULL.
+func compileIn(e *InExpr, s *scope) (*compiledExpr, error) {
+	x, err := compileExpr(e.Expr, s)
+	if err != nil {
+		return nil, err
+	}
+	if e.Select != nil {
+		return compileInSubquery(e, x, s)
+	}
+	items := make([]*compiledExpr, len(e.List))
+	for i, item := range e.List {
+		if items[i], err = compileExpr(item, s); err != nil {
+			return nil, err
+		}
+	}
+	return &compiledExpr{eval: func(row Row) (Value, error) {
+		if len(items) == 0 {
+			return boolValue(e.Not), nil
+		}
+		v, err := x.eval(row)
+		if err != nil || v.IsNull() {
+			return v, err
+		}
+		sawNull := false
+		for _, item := range items {
+			iv, err := item.eval(row)
+			if err != nil {
+				return iv, err
+			}
+			if iv.IsNull() {
+				sawNull = true
+				continue
+			}
+			l, r := prepareComparison(v, x.affinity, iv, AffinityNone)
+			if CompareValues(l, r, x.collation) == 0 {
+				return boolValue(!e.Not), nil
+			}
+		}
+		if sawNull {
+			return NullValue(), nil
+		}
+		return boolValue(e.Not), nil
+	}}, nil
+}
+
+// compileLike evaluates LIKE and GLOB. Both compare the text form of their
+// operands and are NULL when any operand is NULL.
+func compileLike(e *LikeExpr, s *scope) (*compiledExpr, error) {
+	x, err := compileExpr(e.Expr, s)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := compileExpr(e.Pattern, s)
+	if err != nil {
+		return nil, err
+	}
+	var escape *compiledExpr
+	if e.Escape != nil {
+		if escape, err = compileExpr(e.Escape, s); err != nil {
+			return nil, err
+		}
+	}
+	return &compiledExpr{eval: func(row Row) (Value, error) {
+		v, err := x.eval(row)
+		if err != nil {
+			return v, err
+		}
+		pat, err := pattern.eval(row)
+		if err != nil {
+			return pat, err
+		}
+		esc := rune(-1)
+		if escape != nil {
+			ev, err := escape.eval(row)
+			if err != nil {
+				return ev, err
+			}
+			if ev.IsNull() {
+				return NullValue(), nil
+			}
+			runes := []rune(ev.String())
+			if len(runes) != 1 {
+				return Value{}, fmt.Errorf("ESCAPE expression must be a single character")
+			}
+			esc = runes[0]
+		}
+		if v.IsNull() || pat.IsNull() {
+			return NullValue(), nil
+		}
+		var matched bool
+		if e.Op == "GLOB" {
+			matched = globMatch(pat.String(), v.String())
+		} else {
+			matched = likeMatch(pat.String(), v.String(), esc)
+		}
+		return boolValue(matched != e.Not), nil
+	}}, nil
+}
+
+// compileBetween evaluates "x BETWEEN low AND high" as "x >= low AND x <= high".
+func compileBetween(e *BetweenExpr, s *scope) (*compiledExpr, error) {
+	x, err := compileExpr(e.Expr, s)
+	if err != nil {
+		return nil, err
+	}
+	low, err := compileExpr(e.Low, s)
+	if err != nil {
+		return nil, err
+	}
+	high, err := compileExpr(e.High, s)
+	if err != nil {
+		return nil, err
+	}
+	between := compileLogical(true, compileComparison(">=", x, low), compileComparison("<=", x, high))
+	if !e.Not {
+		return between, nil
+	}
+	return &compiledExpr{eval: func(row Row) (Value, error) {
+		v, err := between.eval(row)
+		if err != nil || v.IsNull() {
+			return v, err
+		}
+		return boolValue(v.Int == 0), nil
+	}}, nil
+}
+
+func boolValue(b bool) Value {
+	if b {
+		return IntegerValue(1)
+	}
+	return IntegerValue(0)
+}
+
+// truthValue reports whether v counts as true, and whether it is known at all
+// (NULL is neither true nor false).
+func truthValue(v Value) (truth bool, known bool) {
+	switch v.Type {
+	case TypeNull:
+		return false, false
+	case TypeInteger:
+		return v.Int != 0, true
+	case TypeReal:
+		return v.Real != 0, true
+	}
+	return numericPrefix(string(v.Bytes)).float() != 0, true
+}
+
+func negate(v Value) Value {
+	switch v.Type {
+	case TypeNull:
+		return v
+	case TypeText, TypeBlob:
+		v = numericPrefix(string(v.Bytes))
+	}
+	if v.Type == TypeReal {
+		return RealValue(-v.Real)
+	}
+	if v.Int == math.MinInt64 {
+		return RealValue(-float64(v.Int))
+	}
+	return IntegerValue(-v.Int)
+}
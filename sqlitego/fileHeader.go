@@ -0,0 +1,92 @@
+package sqlitego
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const headerMagic = "SQLite format 3\x00"
+
+// FileHeader is the 100-byte header at the start of every database file.
+type FileHeader struct {
+	PageSize            uint32 // Page size in bytes; 1 on disk means 65536
+	WriteVersion        uint8  // 1 for legacy, 2 for WAL
+	ReadVersion         uint8  // 1 for legacy, 2 for WAL
+	ReservedBytes       uint8  // Unused space at the end of each page
+	MaxPayloadFraction  uint8  // Must be 64
+	MinPayloadFraction  uint8  // Must be 32
+	LeafPayloadFraction uint8  // Must be 32
+	FileChangeCounter   uint32
+	PageCount           uint32 // Database size in pages, valid when VersionValidFor == FileChangeCounter
+	FirstFreelistTrunk  uint32
+	FreelistCount       uint32
+	SchemaCookie        uint32
+	SchemaFormat        uint32 // 1 through 4
+	DefaultCacheSize    uint32
+	AutoVacuumTopRoot   uint32 // Largest root page when in auto-vacuum or incremental-vacuum mode, else 0
+	TextEncoding        uint32 // 1 UTF-8, 2 UTF-16le, 3 UTF-16be
+	UserVersion         uint32
+	IncrementalVacuum   uint32 // Non-zero for incremental-vacuum mode
+	ApplicationID       uint32
+	VersionValidFor     uint32
+	SQLiteVersionNumber uint32
+}
+
+func BuildFileHeader(header []byte) (FileHeader, error) {
+	var fH FileHeader
+
+	if len(header) < fileHeaderSize {
+		return fH, io.ErrShortBuffer
+	}
+	if string(header[:16]) != headerMagic {
+		return fH, errors.New("file is not a SQLite 3 database")
+	}
+
+	u32 := func(offset int) uint32 {
+		return binary.BigEndian.Uint32(header[offset : offset+4])
+	}
+
+	fH.PageSize = uint32(binary.BigEndian.Uint16(header[16:18]))
+	if fH.PageSize == 1 {
+		fH.PageSize = 65536
+	}
+	if fH.PageSize < 512 || fH.PageSize&(fH.PageSize-1) != 0 {
+		return fH, fmt.Errorf("invalid page size %d", fH.PageSize)
+	}
+	fH.WriteVersion = header[18]
+	fH.ReadVersion = header[19]
+	fH.ReservedBytes = header[20]
+	fH.MaxPayloadFraction = header[21]
+	fH.MinPayloadFraction = header[22]
+	fH.LeafPayloadFraction = header[23]
+	fH.FileChangeCounter = u32(24)
+	fH.PageCount = u32(28)
+	fH.FirstFreelistTrunk = u32(32)
+	fH.FreelistCount = u32(36)
+	fH.SchemaCookie = u32(40)
+	fH.SchemaFormat = u32(44)
+	fH.DefaultCacheSize = u32(48)
+	fH.AutoVacuumTopRoot = u32(52)
+	fH.TextEncoding = u32(56)
+	fH.UserVersion = u32(60)
+	fH.IncrementalVacuum = u32(64)
+	fH.ApplicationID = u32(68)
+	fH.VersionValidFor = u32(92)
+	fH.SQLiteVersionNumber = u32(96)
+
+	return fH, nil
+}
+
+func (fH FileHeader) TextEncodingName() string {
+	switch fH.TextEncoding {
+	case 1:
+		return "utf8"
+	case 2:
+		return "utf16le"
+	case 3:
+		return "utf16be"
+	}
+	return ""
+}
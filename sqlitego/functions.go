@@ -0,0 +1,377 @@
+package sqlitego
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// scalarFunc describes a built-in scalar function. maxArgs is -1 when the
+// number of arguments is unbounded. coll is the collation of the first
+// argument that has one, for the functions that compare text.
+type scalarFunc struct {
+	minArgs, maxArgs int
+	call             func(args []Value, coll Collation) (Value, error)
+}
+
+var scalarFuncs map[string]scalarFunc
+
+func init() {
+	scalarFuncs = map[string]scalarFunc{
+		"abs":       {1, 1, absFunc},
+		"nullif":    {2, 2, nullifFunc},
+		"length":    {1, 1, nullOr(lengthFunc)},
+		"lower":     {1, 1, nullOr(func(v Value) Value { return TextValue(strings.Map(asciiLowerRune, v.String())) })},
+		"upper":     {1, 1, nullOr(func(v Value) Value { return TextValue(strings.Map(asciiUpperRune, v.String())) })},
+		"substr":    {2, 3, substrFunc},
+		"substring": {2, 3, substrFunc},
+		"trim":      {1, 2, trimFunc(true, true)},
+		"ltrim":     {1, 2, trimFunc(true, false)},
+		"rtrim":     {1, 2, trimFunc(false, true)},
+		"replace":   {3, 3, replaceFunc},
+		"instr":     {2, 2, instrFunc},
+		"round":     {1, 2, roundFunc},
+		"typeof":    {1, 1, func(args []Value, _ Collation) (Value, error) { return TextValue(typeName(args[0])), nil }},
+		"hex": {1, 1, func(args []Value, _ Collation) (Value, error) {
+			return TextValue(fmt.Sprintf("%X", args[0].String())), nil
+		}},
+		"quote":  {1, 1, func(args []Value, _ Collation) (Value, error) { return TextValue(quoteValue(args[0])), nil }},
+		"printf": {0, -1, printfFunc},
+		"format": {0, -1, printfFunc},
+		"min":    {2, -1, extremumFunc(false)},
+		"max":    {2, -1, extremumFunc(true)},
+		"random": {0, 0, func([]Value, Collation) (Value, error) { return IntegerValue(int64(rand.Uint64())), nil }},
+	}
+}
+
+// compileFunc compiles a call of a scalar function. coalesce() and ifnull()
+// only evaluate the arguments they need.
+func compileFunc(e *FuncCall, s *scope) (*compiledExpr, error) {
+	name := strings.ToLower(e.Name)
+	fn, ok := scalarFuncs[name]
+	if name == "coalesce" || name == "ifnull" {
+		fn, ok = scalarFunc{minArgs: 2, maxArgs: -1}, true
+		if name == "ifnull" {
+			fn.maxArgs = 2
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("no such function: %s", e.Name)
+	}
+	if e.Star || len(e.Args) < fn.minArgs || fn.maxArgs >= 0 && len(e.Args) > fn.maxArgs {
+		return nil, fmt.Errorf("wrong number of arguments to function %s()", e.Name)
+	}
+	args := make([]*compiledExpr, len(e.Args))
+	var coll Collation
+	for i, arg := range e.Args {
+		compiled, err := compileExpr(arg, s)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = compiled
+		if coll == nil {
+			coll = compiled.collation
+		}
+	}
+	if fn.call == nil {
+		return &compiledExpr{eval: func(row Row) (Value, error) {
+			for _, arg := range args {
+				v, err := arg.eval(row)
+				if err != nil || !v.IsNull() {
+					return v, err
+				}
+			}
+			return NullValue(), nil
+		}}, nil
+	}
+	return &compiledExpr{eval: func(row Row) (Value, error) {
+		values := make([]Value, len(args))
+		for i, arg := range args {
+			v, err := arg.eval(row)
+			if err != nil {
+				return v, err
+			}
+			values[i] = v
+		}
+		return fn.call(values, coll)
+	}}, nil
+}
+
+// nullOr turns a function of one argument into one that returns NULL for NULL.
+func nullOr(f func(v Value) Value) func([]Value, Collation) (Value, error) {
+	return func(args []Value, _ Collation) (Value, error) {
+		if args[0].IsNull() {
+			return args[0], nil
+		}
+		return f(args[0]), nil
+	}
+}
+
+// anyNull reports whether one of args is NULL, which makes most functions NULL.
+func anyNull(args []Value) bool {
+	for _, v := range args {
+		if v.IsNull() {
+			return true
+		}
+	}
+	return false
+}
+
+func absFunc(args []Value, _ Collation) (Value, error) {
+	switch v := args[0]; v.Type {
+	case TypeNull:
+		return v, nil
+	case TypeInteger:
+		if v.Int == math.MinInt64 {
+			return Value{}, fmt.Errorf("integer overflow")
+		}
+		if v.Int < 0 {
+			return IntegerValue(-v.Int), nil
+		}
+		return v, nil
+	default:
+		return RealValue(math.Abs(realValue(v))), nil
+	}
+}
+
+func nullifFunc(args []Value, coll Collation) (Value, error) {
+	if CompareValues(args[0], args[1], coll) == 0 {
+		return NullValue(), nil
+	}
+	return args[0], nil
+}
+
+// lengthFunc counts the characters of text up to the first NUL, and the bytes
+// of a blob.
+func lengthFunc(v Value) Value {
+	if v.Type == TypeBlob {
+		return IntegerValue(int64(len(v.Bytes)))
+	}
+	s := v.String()
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return IntegerValue(int64(utf8.RuneCountInString(s)))
+}
+
+// The case conversions of SQLite's built-in lower() and upper() are ASCII
+// only.
+func asciiLowerRune(r rune) rune {
+	if r >= 'A' && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+	return r
+}
+
+func asciiUpperRune(r rune) rune {
+	if r >= 'a' && r <= 'z' {
+		return r - 'a' + 'A'
+	}
+	return r
+}
+
+// substrFunc implements substr(X, Y[, Z]) with the arithmetic of SQLite's
+// substrFunc: positions count from 1, a negative Y counts from the end and a
+// negative Z takes the characters before Y. Blobs are cut by bytes.
+func substrFunc(args []Value, _ Collation) (Value, error) {
+	if anyNull(args) {
+		return NullValue(), nil
+	}
+	x := args[0]
+	var units []int // byte offset of each character
+	s := x.String()
+	if x.Type == TypeBlob {
+		s = string(x.Bytes)
+	} else {
+		for i := range s {
+			units = append(units, i)
+		}
+	}
+	length := int64(len(units))
+	if x.Type == TypeBlob {
+		length = int64(len(s))
+	}
+	p1 := intValue(args[1])
+	p2 := int64(math.MaxInt32)
+	negP2 := false
+	if len(args) == 3 {
+		p2 = intValue(args[2])
+		if p2 < 0 {
+			negP2, p2 = true, -p2
+		}
+	}
+	switch {
+	case p1 < 0:
+		p1 += length
+		if p1 < 0 {
+			p2 = max(p2+p1, 0)
+			p1 = 0
+		}
+	case p1 > 0:
+		p1--
+	case p2 > 0:
+		p2--
+	}
+	if negP2 {
+		p1 -= p2
+		if p1 < 0 {
+			p2 += p1
+			p1 = 0
+		}
+	}
+	p1 = min(p1, length)
+	p2 = max(min(p2, length-p1), 0)
+	if x.Type == TypeBlob {
+		return BlobValue(x.Bytes[p1 : p1+p2]), nil
+	}
+	start, end := len(s), len(s)
+	if p1 < length {
+		start = units[p1]
+	}
+	if p1+p2 < length {
+		end = units[p1+p2]
+	}
+	return TextValue(s[start:end]), nil
+}
+
+// trimFunc removes the characters of the second argument, or spaces, from the
+// chosen ends of the first.
+func trimFunc(left, right bool) func([]Value, Collation) (Value, error) {
+	return func(args []Value, _ Collation) (Value, error) {
+		if anyNull(args) {
+			return NullValue(), nil
+		}
+		s, cutset := args[0].String(), " "
+		if len(args) == 2 {
+			cutset = args[1].String()
+		}
+		if left {
+			s = strings.TrimLeft(s, cutset)
+		}
+		if right {
+			s = strings.TrimRight(s, cutset)
+		}
+		return TextValue(s), nil
+	}
+}
+
+// replaceFunc replaces every occurrence of Y in X by Z. An empty Y leaves the
+// text of X unchanged.
+func replaceFunc(args []Value, _ Collation) (Value, error) {
+	if anyNull(args) {
+		return NullValue(), nil
+	}
+	pattern := args[1].String()
+	if pattern == "" {
+		return TextValue(args[0].String()), nil
+	}
+	return TextValue(strings.ReplaceAll(args[0].String(), pattern, args[2].String())), nil
+}
+
+// instrFunc returns the 1-based character position of the first occurrence of
+// Y in X, or 0. Between two blobs the position counts bytes.
+func instrFunc(args []Value, _ Collation) (Value, error) {
+	if anyNull(args) {
+		return NullValue(), nil
+	}
+	if args[0].Type == TypeBlob && args[1].Type == TypeBlob {
+		return IntegerValue(int64(strings.Index(string(args[0].Bytes), string(args[1].Bytes)) + 1)), nil
+	}
+	s := args[0].String()
+	i := strings.Index(s, args[1].String())
+	if i < 0 {
+		return IntegerValue(0), nil
+	}
+	return IntegerValue(int64(utf8.RuneCountInString(s[:i]) + 1)), nil
+}
+
+// roundFunc rounds X to N decimal places, half away from zero, on the decimal
+// digits of X as printf() shows them. The result is always REAL.
+func roundFunc(args []Value, _ Collation) (Value, error) {
+	if anyNull(args) {
+		return NullValue(), nil
+	}
+	n := int64(0)
+	if len(args) == 2 {
+		n = min(max(intValue(args[1]), 0), 30)
+	}
+	r := realValue(args[0])
+	// Such values have no fractional part.
+	if r < -(1<<52) || r > 1<<52 {
+		return RealValue(r), nil
+	}
+	if n == 0 {
+		if r < 0 {
+			return RealValue(float64(int64(r - 0.5))), nil
+		}
+		return RealValue(float64(int64(r + 0.5))), nil
+	}
+	rounded, err := strconv.ParseFloat(formatFloat(r, printfSpec{bang: true, precision: int(n), verb: 'f'}), 64)
+	if err != nil {
+		return Value{}, fmt.Errorf("failed to round %v: %w", r, err)
+	}
+	return RealValue(rounded), nil
+}
+
+func typeName(v Value) string {
+	switch v.Type {
+	case TypeInteger:
+		return "integer"
+	case TypeReal:
+		return "real"
+	case TypeText:
+		return "text"
+	case TypeBlob:
+		return "blob"
+	}
+	return "null"
+}
+
+// quoteValue renders v as an SQL literal. REALs get enough digits to read back
+// as the same value.
+func quoteValue(v Value) string {
+	switch v.Type {
+	case TypeNull:
+		return "NULL"
+	case TypeInteger:
+		return v.String()
+	case TypeReal:
+		s := formatFloat(v.Real, printfSpec{bang: true, zeroPad: true, precision: 15, verb: 'g'})
+		if f, err := strconv.ParseFloat(s, 64); err != nil || f != v.Real {
+			s = formatFloat(v.Real, printfSpec{bang: true, zeroPad: true, precision: 20, verb: 'e'})
+		}
+		return s
+	case TypeBlob:
+		return fmt.Sprintf("X'%X'", v.Bytes)
+	}
+	return "'" + strings.ReplaceAll(v.String(), "'", "''") + "'"
+}
+
+func printfFunc(args []Value, _ Collation) (Value, error) {
+	if len(args) == 0 || args[0].IsNull() {
+		return NullValue(), nil
+	}
+	return TextValue(sqlPrintf(args[0].String(), args[1:])), nil
+}
+
+// extremumFunc implements the scalar min() and max(), which are NULL when any
+// argument is. Among equal arguments min() returns the last and max() the
+// first, as SQLite does.
+func extremumFunc(isMax bool) func([]Value, Collation) (Value, error) {
+	return func(args []Value, coll Collation) (Value, error) {
+		if anyNull(args) {
+			return NullValue(), nil
+		}
+		best := args[0]
+		for _, v := range args[1:] {
+			c := CompareValues(best, v, coll)
+			if isMax && c < 0 || !isMax && c >= 0 {
+				best = v
+			}
+		}
+		return best, nil
+	}
+}
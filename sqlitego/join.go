@@ -0,0 +1,755 @@
+package sqlitego
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// maxJoinTables is the most tables a FROM clause may join, as in SQLite.
+const maxJoinTables = 64
+
+// assumedTableRows is how many rows the join planner assumes every table holds.
+// Like SQLite without ANALYZE, it knows nothing about the actual sizes, so join
+// orders are chosen by the indexes that can serve each table.
+const assumedTableRows = 1 << 20
+
+// fromTable is a table of the FROM clause.
+type fromTable struct {
+	ref    *TableRef
+	entry  SchemaEntry
+	def    *TableDef
+	offset int    // position of the table's first column in the joined row
+	on     []Expr // conjuncts of the ON clause and of the USING columns
+	// query is the planned subquery of a subquery in FROM, whose rows a join
+	// reads into rows the first time it loops over them.
+	query *query
+	rows  []Row
+	reads *columnReads // the columns of the table the query reads
+	// working is set for the working table of a recursive step, which holds
+	// another row every time the step runs.
+	working bool
+}
+
+// resolveFrom looks up the tables of FROM and builds the scope of the joined
+// row, which holds the columns of every table in FROM order.
+func resolveFrom(ctx *queryContext, from []*TableRef) ([]*fromTable, *scope, error) {
+	if len(from) > maxJoinTables {
+		return nil, nil, fmt.Errorf("at most %d tables in a join", maxJoinTables)
+	}
+	sc := &scope{}
+	var tables []*fromTable
+	for _, ref := range from {
+		t, tableScope, err := fromTableOf(ctx, ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		name := tableScope.columns[len(tableScope.columns)-1].Table
+		t.offset, t.on = len(sc.columns), splitConjuncts(ref.On)
+		using := ref.Using
+		if ref.Natural {
+			using = naturalColumns(sc, tableScope)
+		}
+		for _, column := range using {
+			left := -1
+			for i, col := range sc.columns {
+				if !col.Using && !col.Hidden && strings.EqualFold(col.Name, column) {
+					left = i
+					break
+				}
+			}
+			right := -1
+			for i, col := range tableScope.columns {
+				if !col.Hidden && strings.EqualFold(col.Name, column) {
+					right = i
+					break
+				}
+			}
+			if left < 0 || right < 0 {
+				return nil, nil, fmt.Errorf("cannot join using column %s - column not present in both tables", column)
+			}
+			tableScope.columns[right].Using = true
+			t.on = append(t.on, &BinaryExpr{
+				Op:    "=",
+				Left:  &ColumnRef{Table: sc.columns[left].Table, Column: sc.columns[left].Name, position: left + 1},
+				Right: &ColumnRef{Table: name, Column: tableScope.columns[right].Name, position: t.offset + right + 1},
+			})
+		}
+		sc.columns = append(sc.columns, tableScope.columns...)
+		tables = append(tables, t)
+	}
+	return tables, sc, nil
+}
+
+// fromTableOf looks up the table ref names, or plans its subquery or common
+// table, and builds the scope of its rows.
+func fromTableOf(ctx *queryContext, ref *TableRef) (*fromTable, *scope, error) {
+	if ref.Subquery != nil {
+		q, err := planSelect(ctx, ref.Subquery)
+		if err != nil {
+			return nil, nil, err
+		}
+		t, s := derivedTable(ref, ref.Alias, q)
+		return t, s, nil
+	}
+	if c := ctx.with.lookup(ref.Name); c != nil {
+		q, err := c.plan()
+		if err != nil {
+			return nil, nil, err
+		}
+		name := c.table.Name
+		if ref.Alias != "" {
+			name = ref.Alias
+		}
+		t, s := derivedTable(ref, name, q)
+		t.working = c.working != nil
+		return t, s, nil
+	}
+	if view, ok := ctx.catalog.View(ref.Name); ok {
+		q, err := planView(ctx, view)
+		if err != nil {
+			return nil, nil, err
+		}
+		name := view.Name
+		if ref.Alias != "" {
+			name = ref.Alias
+		}
+		t, s := derivedTable(ref, name, q)
+		return t, s, nil
+	}
+	table, ok := ctx.catalog.Table(ref.Name)
+	if !ok || table.RootPage == 0 {
+		return nil, nil, fmt.Errorf("table %s not found in database", ref.Name)
+	}
+	def, err := ctx.catalog.TableDef(table)
+	if err != nil {
+		return nil, nil, err
+	}
+	if def.WithoutRowid {
+		return nil, nil, fmt.Errorf("table %s is a WITHOUT ROWID table, which is not supported yet", ref.Name)
+	}
+	name := table.Name
+	if ref.Alias != "" {
+		name = ref.Alias
+	}
+	tableScope, err := newTableScope(name, def)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &fromTable{ref: ref, entry: table, def: def}, tableScope, nil
+}
+
+// naturalColumns lists the columns of right that share their name with a column
+// of left.
+func naturalColumns(left, right *scope) []string {
+	var names []string
+	for _, col := range right.columns {
+		if col.Hidden {
+			continue
+		}
+		for _, l := range left.columns {
+			if !l.Using && !l.Hidden && strings.EqualFold(l.Name, col.Name) {
+				names = append(names, col.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// joinTerm is a conjunct of the WHERE clause or of an ON clause.
+type joinTerm struct {
+	cond   *compiledExpr
+	tables uint64 // bit i is set when the term reads table i of FROM
+	// on is the FROM position of the LEFT JOIN whose ON clause holds the term, or
+	// -1. Such a term decides whether a row of that table matches rather than
+	// whether a joined row is kept.
+	on int
+}
+
+// joinKey is a term comparing a column of a table with a constant or with a
+// column of another table, which may narrow the rows read from the table.
+type joinKey struct {
+	table     int
+	term      indexTerm // value is filled in from the joined row
+	value     *compiledExpr
+	collation Collation // the column's, which the comparison uses
+	needs     uint64    // the tables value reads
+	on        int
+}
+
+// planJoin plans a nested-loop join of tables: it picks the order the tables
+// are looped over and how each one is read, and places every term of where and
+// of the ON clauses at the first loop that can evaluate it.
+func planJoin(pager *Pager, catalog *Catalog, tables []*fromTable, sc *scope, where Expr) (rowSource, error) {
+	var terms []joinTerm
+	var keys []joinKey
+	addTerm := func(expr Expr, on int) error {
+		reads := map[int]bool{}
+		termScope := *sc
+		termScope.reads = reads
+		cond, err := compileExpr(expr, &termScope)
+		if err != nil {
+			return err
+		}
+		var mask uint64
+		for idx := range reads {
+			mask |= 1 << tableAt(tables, idx)
+			if sc.reads != nil {
+				sc.reads[idx] = true
+			}
+		}
+		if on >= 0 && mask>>(on+1) != 0 {
+			return fmt.Errorf("ON clause references tables to its right")
+		}
+		terms = append(terms, joinTerm{cond: cond, tables: mask, on: on})
+		found, err := joinKeys(expr, tables, sc, on)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, found...)
+		return nil
+	}
+	for i, t := range tables {
+		on := -1
+		if t.ref.Join == "LEFT" {
+			on = i
+		}
+		for _, expr := range t.on {
+			if err := addTerm(expr, on); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, expr := range splitConjuncts(where) {
+		if err := addTerm(expr, -1); err != nil {
+			return nil, err
+		}
+	}
+
+	order, accesses, err := chooseJoinOrder(catalog, tables, keys)
+	if err != nil {
+		return nil, err
+	}
+	position := make([]int, len(tables))
+	for pos, t := range order {
+		position[t] = pos
+	}
+	levels := make([]*joinLevel, len(order))
+	for pos, t := range order {
+		levels[pos] = &joinLevel{
+			table:  tables[t],
+			access: accesses[pos],
+			left:   tables[t].ref.Join == "LEFT",
+			pager:  pager,
+		}
+	}
+	for _, term := range terms {
+		if term.on >= 0 {
+			level := levels[position[term.on]]
+			level.on = append(level.on, term.cond)
+			continue
+		}
+		pos := 0
+		for t := range tables {
+			if term.tables&(1<<t) != 0 {
+				pos = max(pos, position[t])
+			}
+		}
+		levels[pos].where = append(levels[pos].where, term.cond)
+	}
+	return &nestedLoop{levels: levels, row: make(Row, len(sc.columns))}, nil
+}
+
+// tableAt returns the FROM position of the table holding column idx of the
+// joined row.
+func tableAt(tables []*fromTable, idx int) int {
+	for i := len(tables) - 1; i > 0; i-- {
+		if idx >= tables[i].offset {
+			return i
+		}
+	}
+	return 0
+}
+
+// joinKeys finds the comparisons in expr that can narrow the rows of a table.
+// A comparison of two columns gives a key for each side.
+func joinKeys(expr Expr, tables []*fromTable, sc *scope, on int) ([]joinKey, error) {
+	e, ok := expr.(*BinaryExpr)
+	if !ok {
+		return nil, nil
+	}
+	if _, ok := mirroredOps[e.Op]; !ok {
+		return nil, nil
+	}
+	var keys []joinKey
+	for _, side := range []struct {
+		col, other Expr
+		op         string
+	}{{e.Left, e.Right, e.Op}, {e.Right, e.Left, mirroredOps[e.Op]}} {
+		ref, ok := side.col.(*ColumnRef)
+		if !ok {
+			continue
+		}
+		idx, err := sc.resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		if idx < 0 {
+			continue
+		}
+		table := tableAt(tables, idx)
+		column := sc.columns[idx]
+		key := joinKey{table: table, term: indexTerm{colIdx: idx - tables[table].offset, op: side.op}, collation: column.Collation, on: on}
+		if v, ok := termValue(side.other, ref, sc, side.col == e.Right); ok {
+			if v.IsNull() {
+				continue
+			}
+			key.value, key.term.value = constExpr(v), v
+			keys = append(keys, key)
+			continue
+		}
+		otherRef, ok := side.other.(*ColumnRef)
+		if !ok {
+			continue
+		}
+		otherIdx, err := sc.resolve(otherRef)
+		if err != nil {
+			return nil, err
+		}
+		if otherIdx < 0 || tableAt(tables, otherIdx) == table {
+			continue
+		}
+		other := sc.columns[otherIdx]
+		// The index holds the column's values as stored, so it only helps when the
+		// comparison converts the other operand rather than the column, and uses the
+		// column's own collation: that of the left operand, or of the right one when
+		// the left, a subquery's column, has none.
+		if other.Affinity.isNumeric() && !column.Affinity.isNumeric() ||
+			other.Affinity == AffinityText && column.Affinity == AffinityNone {
+			continue
+		}
+		left, right := column, other
+		if side.col == e.Right {
+			left, right = other, column
+		}
+		collation := left.Collation
+		if collation == nil {
+			collation = right.Collation
+		}
+		if !sameCollation(collation, column.Collation) {
+			continue
+		}
+		key.value = &compiledExpr{eval: func(row Row) (Value, error) { return row[otherIdx], nil }}
+		key.term.value = IntegerValue(0)
+		key.needs = 1 << tableAt(tables, otherIdx)
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// tableAccess is how a loop of the join reads its table for each row of the
+// loops around it.
+type tableAccess struct {
+	rowid *joinKey  // fetch the row whose rowid equals the key
+	index *IndexDef // or seek this index with keys
+	root  int       // root page of index
+	auto  bool      // or seek an automatic index on the columns of keys
+	keys  []joinKey // the keys the index is sought with
+	rows  float64   // estimated rows read per row of the outer loops
+	cost  float64   // estimated cost of reading them
+	setup float64   // estimated cost of building an automatic index, paid once
+}
+
+// bestAccess picks the cheapest way to read table t once the tables in bound
+// are available, for outer rows of the loops around it.
+func bestAccess(catalog *Catalog, tables []*fromTable, t int, bound uint64, keys []joinKey, outer float64) (*tableAccess, error) {
+	tbl := tables[t]
+	on := -1
+	if tbl.ref.Join == "LEFT" {
+		on = t
+	}
+	var usable []joinKey
+	for _, key := range keys {
+		if key.table == t && key.on == on && key.needs&^bound == 0 {
+			usable = append(usable, key)
+		}
+	}
+	seek := math.Log2(assumedTableRows)
+	best := &tableAccess{rows: assumedTableRows, cost: assumedTableRows}
+	for i, key := range usable {
+		if tbl.def.isRowid(key.term.colIdx) && key.term.op == "=" {
+			return &tableAccess{rowid: &usable[i], rows: 1, cost: seek}, nil
+		}
+	}
+	terms := make([]indexTerm, len(usable))
+	for i, key := range usable {
+		terms[i] = key.term
+	}
+	for _, entry := range catalog.IndexesOn(tbl.entry.Name) {
+		index, err := catalog.IndexDef(entry)
+		if err != nil {
+			return nil, err
+		}
+		if index.Where != "" {
+			continue
+		}
+		plan, err := planIndex(index, entry.RootPage, tbl.def, terms)
+		if err != nil {
+			return nil, err
+		}
+		if plan == nil {
+			continue
+		}
+		// SQLite's guesses without statistics: an equality on an index leaves ten
+		// rows, or one on a whole unique index, and each range bound a quarter.
+		rows := float64(assumedTableRows)
+		switch {
+		case plan.eq == len(index.Columns) && index.Unique:
+			rows = 1
+		case plan.eq > 0:
+			rows = 10
+		}
+		for range plan.score - 4*plan.eq {
+			rows /= 4
+		}
+		rows = max(rows, 1)
+		if cost := seek + rows*seek; cost < best.cost {
+			best = &tableAccess{index: index, root: entry.RootPage, keys: usable, rows: rows, cost: cost}
+		}
+	}
+	// Without an index for its equality keys, a table is given an automatic one
+	// when building it, which reads the table once, costs less than scanning the
+	// table for every outer row. The working table of a recursive step holds
+	// another row every time, so it is never indexed.
+	if best.index != nil || tbl.working {
+		return best, nil
+	}
+	var eq []joinKey
+	for _, key := range usable {
+		if key.term.op == "=" && !slices.ContainsFunc(eq, func(k joinKey) bool { return k.term.colIdx == key.term.colIdx }) {
+			eq = append(eq, key)
+		}
+	}
+	if len(eq) > 0 {
+		auto := &tableAccess{auto: true, keys: eq, rows: 10, cost: seek + 10*seek, setup: assumedTableRows * seek}
+		if auto.setup+outer*auto.cost < outer*best.cost {
+			best = auto
+		}
+	}
+	return best, nil
+}
+
+// chooseJoinOrder returns the loop order of tables, outermost first, with how
+// each loop reads its table. The right table of a LEFT or CROSS JOIN stays
+// after every table to its left. All orders are tried for up to eight tables;
+// larger joins are ordered greedily.
+func chooseJoinOrder(catalog *Catalog, tables []*fromTable, keys []joinKey) ([]int, []*tableAccess, error) {
+	var bestOrder []int
+	var bestAccesses []*tableAccess
+	bestCost := math.Inf(1)
+	order := make([]int, 0, len(tables))
+	accesses := make([]*tableAccess, 0, len(tables))
+	var search func(bound uint64, rows, cost float64) error
+	search = func(bound uint64, rows, cost float64) error {
+		if cost >= bestCost {
+			return nil
+		}
+		if len(order) == len(tables) {
+			bestCost = cost
+			bestOrder = append([]int(nil), order...)
+			bestAccesses = append([]*tableAccess(nil), accesses...)
+			return nil
+		}
+		type candidate struct {
+			table  int
+			access *tableAccess
+		}
+		var candidates []candidate
+		for t, tbl := range tables {
+			if bound&(1<<t) != 0 {
+				continue
+			}
+			if (tbl.ref.Join == "LEFT" || tbl.ref.Join == "CROSS") && bound&(1<<t-1) != 1<<t-1 {
+				continue
+			}
+			access, err := bestAccess(catalog, tables, t, bound, keys, rows)
+			if err != nil {
+				return err
+			}
+			candidates = append(candidates, candidate{t, access})
+		}
+		if len(tables) > 8 {
+			cheapest := candidates[0]
+			for _, c := range candidates[1:] {
+				if c.access.cost < cheapest.access.cost {
+					cheapest = c
+				}
+			}
+			candidates = []candidate{cheapest}
+		}
+		for _, c := range candidates {
+			order, accesses = append(order, c.table), append(accesses, c.access)
+			err := search(bound|1<<c.table, rows*c.access.rows, cost+c.access.setup+rows*c.access.cost)
+			order, accesses = order[:len(order)-1], accesses[:len(accesses)-1]
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := search(0, 1, 0); err != nil {
+		return nil, nil, err
+	}
+	return bestOrder, bestAccesses, nil
+}
+
+// joinLevel is one loop of a nested-loop join.
+type joinLevel struct {
+	table   *fromTable
+	access  *tableAccess
+	pager   *Pager
+	left    bool            // a LEFT JOIN: a row of NULLs stands in when nothing matches
+	on      []*compiledExpr // conditions for a row of the table to match
+	where   []*compiledExpr // conditions for the joined row to be kept
+	src     rowSource
+	auto    *autoIndex // built by the first open of a level that seeks one
+	matched bool
+	padded  bool
+}
+
+// open starts reading the rows of the level's table that may join the outer
+// row.
+func (l *joinLevel) open(row Row) error {
+	l.matched, l.padded = false, false
+	if l.src != nil {
+		if err := l.src.Close(); err != nil {
+			return err
+		}
+	}
+	def, root := l.table.def, l.table.entry.RootPage
+	switch {
+	case l.access.auto:
+		if l.auto == nil {
+			var src rowSource
+			if l.table.query != nil {
+				rows, err := l.table.derivedRows()
+				if err != nil {
+					return err
+				}
+				src = &rowList{rows: rows}
+			} else {
+				scan := newTableScan(l.pager, root, def)
+				scan.reads = l.table.reads
+				src = scan
+			}
+			var err error
+			if l.auto, err = newAutoIndex(src, def, l.access.keys); err != nil {
+				return err
+			}
+		}
+		values := make([]Value, len(l.access.keys))
+		for i, key := range l.access.keys {
+			v, err := key.value.eval(row)
+			if err != nil {
+				return err
+			}
+			values[i] = v
+		}
+		l.src = &rowList{rows: l.auto.seek(values)}
+	case l.table.query != nil:
+		rows, err := l.table.derivedRows()
+		if err != nil {
+			return err
+		}
+		l.src = &rowList{rows: rows}
+	case l.access.rowid != nil:
+		v, err := l.access.rowid.value.eval(row)
+		if err != nil {
+			return err
+		}
+		rowid, ok := rowidKey(v)
+		if !ok {
+			l.src = &singleRow{done: true}
+			return nil
+		}
+		l.src = &rowidLookup{def: def, cursor: NewCursor(l.pager, root), reads: l.table.reads, rowid: rowid}
+	case l.access.index != nil:
+		terms := make([]indexTerm, len(l.access.keys))
+		for i, key := range l.access.keys {
+			v, err := key.value.eval(row)
+			if err != nil {
+				return err
+			}
+			if v.IsNull() {
+				l.src = &singleRow{done: true}
+				return nil
+			}
+			terms[i] = key.term
+			terms[i].value = v
+		}
+		plan, err := planIndex(l.access.index, l.access.root, def, terms)
+		if err != nil {
+			return err
+		}
+		scan := newIndexScan(l.pager, root, def, plan)
+		scan.reads = l.table.reads
+		l.src = scan
+	default:
+		scan := newTableScan(l.pager, root, def)
+		scan.reads = l.table.reads
+		l.src = scan
+	}
+	return nil
+}
+
+// derivedRows returns the rows of a subquery in FROM, which are read the first
+// time they are needed.
+func (t *fromTable) derivedRows() ([]Row, error) {
+	if t.rows == nil {
+		rows, err := readAll(&derivedRows{src: t.query.rows})
+		if err != nil {
+			return nil, err
+		}
+		t.rows = rows
+	}
+	return t.rows, nil
+}
+
+// rowidKey converts a value compared with a rowid to the rowid it can equal.
+func rowidKey(v Value) (int64, bool) {
+	v = v.applyAffinity(AffinityInteger)
+	switch v.Type {
+	case TypeInteger:
+		return v.Int, true
+	case TypeReal:
+		return realAsInteger(v.Real)
+	}
+	return 0, false
+}
+
+// next advances the level to its next row that joins the outer row, writing
+// the row's values into the joined row.
+func (l *joinLevel) next(row Row) (bool, error) {
+	width := len(l.table.def.Columns) + 1
+	for {
+		ok, err := l.src.Next()
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			if !l.left || l.matched || l.padded {
+				return false, nil
+			}
+			l.padded = true
+			for i := range width {
+				row[l.table.offset+i] = NullValue()
+			}
+			return allTrue(l.where, row)
+		}
+		copy(row[l.table.offset:], l.src.Row()[:width])
+		if ok, err := allTrue(l.on, row); !ok || err != nil {
+			if err != nil {
+				return false, err
+			}
+			continue
+		}
+		l.matched = true
+		if ok, err := allTrue(l.where, row); ok || err != nil {
+			return ok, err
+		}
+	}
+}
+
+func allTrue(conds []*compiledExpr, row Row) (bool, error) {
+	for _, cond := range conds {
+		v, err := cond.eval(row)
+		if err != nil {
+			return false, err
+		}
+		if truth, _ := truthValue(v); !truth {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// nestedLoop joins the tables of its levels, looping over each level's rows
+// for every row of the levels before it.
+type nestedLoop struct {
+	levels  []*joinLevel
+	row     Row // the joined row being built
+	depth   int
+	started bool
+	done    bool
+	out     Row
+}
+
+func (j *nestedLoop) Next() (bool, error) {
+	if j.done {
+		return false, nil
+	}
+	if !j.started {
+		j.started = true
+		if err := j.levels[0].open(j.row); err != nil {
+			return false, err
+		}
+	}
+	for {
+		level := j.levels[j.depth]
+		// A LEFT JOIN may still owe its row of NULLs, so a padded level is only
+		// finished once next reports no more rows.
+		ok, err := level.next(j.row)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			if j.depth == 0 {
+				j.done = true
+				return false, nil
+			}
+			j.depth--
+			continue
+		}
+		if j.depth == len(j.levels)-1 {
+			j.out = append(Row(nil), j.row...)
+			return true, nil
+		}
+		j.depth++
+		if err := j.levels[j.depth].open(j.row); err != nil {
+			return false, err
+		}
+	}
+}
+
+func (j *nestedLoop) Row() Row {
+	return j.out
+}
+
+// rewind starts the join over. The rows of subqueries in FROM are read again,
+// as they change between runs for the working table of a recursive step.
+func (j *nestedLoop) rewind() bool {
+	for _, level := range j.levels {
+		if level.table.query != nil {
+			if !rewind(level.table.query.rows) {
+				return false
+			}
+			level.table.rows, level.auto = nil, nil
+		}
+	}
+	j.started, j.done, j.depth = false, false, 0
+	return true
+}
+
+func (j *nestedLoop) Close() error {
+	var errs []error
+	for _, level := range j.levels {
+		if level.src != nil {
+			errs = append(errs, level.src.Close())
+		}
+	}
+	j.done = true
+	return errors.Join(errs...)
+}
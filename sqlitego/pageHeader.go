@@ -0,0 +1,95 @@
+package sqlitego
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// B-tree page types, as stored in the first byte of the page header.
+const (
+	pageTypeInteriorIndex = 2
+	pageTypeInteriorTable = 5
+	pageTypeLeafIndex     = 10
+	pageTypeLeafTable     = 13
+)
+
+// Page 1 starts with the 100-byte database file header; its B-tree header follows it.
+const fileHeaderSize = 100
+
+type PageHeader struct {
+	PageType            uint8
+	FirstFreeblock      uint16
+	NumberOfCells       uint16
+	CellContentArea     uint32 // 0 on disk means 65536
+	FragmentedFreeBytes byte
+	RightMostPointer    uint32 // only set on interior pages
+	CellPointers        []uint16
+}
+
+func (h PageHeader) IsLeaf() bool {
+	return h.PageType == pageTypeLeafTable || h.PageType == pageTypeLeafIndex
+}
+
+func (h PageHeader) IsTable() bool {
+	return h.PageType == pageTypeLeafTable || h.PageType == pageTypeInteriorTable
+}
+
+// Size of the B-tree header itself: 12 bytes for interior pages, 8 for leaves.
+func (h PageHeader) Size() int {
+	if h.IsLeaf() {
+		return 8
+	}
+	return 12
+}
+
+// DecodePageHeader parses the B-tree page header and cell pointer array of page
+// pageNum. Cell pointers are offsets from the start of the page, including on page 1.
+func DecodePageHeader(page []byte, pageNum int) (PageHeader, error) {
+	var pH PageHeader
+
+	offset := 0
+	if pageNum == 1 {
+		offset = fileHeaderSize
+	}
+	if len(page) < offset+8 {
+		return pH, fmt.Errorf("page %d is too short for a b-tree header", pageNum)
+	}
+	hdr := page[offset:]
+
+	pH.PageType = hdr[0]
+	switch pH.PageType {
+	case pageTypeInteriorIndex, pageTypeInteriorTable, pageTypeLeafIndex, pageTypeLeafTable:
+	default:
+		return pH, fmt.Errorf("page %d has invalid b-tree page type %d", pageNum, pH.PageType)
+	}
+	pH.FirstFreeblock = binary.BigEndian.Uint16(hdr[1:3])
+	pH.NumberOfCells = binary.BigEndian.Uint16(hdr[3:5])
+	pH.CellContentArea = uint32(binary.BigEndian.Uint16(hdr[5:7]))
+	if pH.CellContentArea == 0 {
+		pH.CellContentArea = 65536
+	}
+	pH.FragmentedFreeBytes = hdr[7]
+
+	headerSize := pH.Size()
+	if len(hdr) < headerSize {
+		return pH, fmt.Errorf("page %d is too short for a b-tree header", pageNum)
+	}
+	if !pH.IsLeaf() {
+		pH.RightMostPointer = binary.BigEndian.Uint32(hdr[8:12])
+	}
+
+	cellArray := hdr[headerSize:]
+	if len(cellArray) < int(pH.NumberOfCells)*2 {
+		return pH, fmt.Errorf("page %d: cell pointer array overflows the page (%d cells)", pageNum, pH.NumberOfCells)
+	}
+	pH.CellPointers = make([]uint16, pH.NumberOfCells)
+	for i := range pH.CellPointers {
+		ptr := binary.BigEndian.Uint16(cellArray[i*2 : i*2+2])
+		if int(ptr) >= len(page) {
+			return pH, fmt.Errorf("page %d: cell pointer %d out of range", pageNum, ptr)
+		}
+		pH.CellPointers[i] = ptr
+	}
+
+	return pH, nil
+}
@@ -0,0 +1,148 @@
+package sqlitego
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Number of pages kept in memory when the caller does not ask for a specific size.
+const defaultPageCacheSize = 256
+
+type Page struct {
+	Number int
+	Data   []byte
+	Header *PageHeader // decoded on first ReadBTreePage, then cached with the page
+}
+
+// Pager owns the database file and hands out pages by number, keeping the most
+// recently used ones in an LRU cache so repeated B-tree descents do not hit the disk.
+type Pager struct {
+	file       *os.File
+	header     FileHeader
+	pageSize   int
+	usableSize int // page size minus the reserved bytes at the end of every page
+	cache      *pageCache
+}
+
+func OpenPager(databaseFilePath string, cacheSize int) (*Pager, error) {
+	file, err := os.Open(databaseFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database file: %w", err)
+	}
+
+	header := make([]byte, 100)
+	if _, err := io.ReadFull(file, header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read database header: %w", err)
+	}
+	fH, err := BuildFileHeader(header)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to build file header: %w", err)
+	}
+
+	return &Pager{
+		file:       file,
+		header:     fH,
+		pageSize:   int(fH.PageSize),
+		usableSize: int(fH.PageSize) - int(fH.ReservedBytes),
+		cache:      newPageCache(cacheSize),
+	}, nil
+}
+
+func (p *Pager) Header() FileHeader {
+	return p.header
+}
+
+func (p *Pager) PageSize() int {
+	return p.pageSize
+}
+
+// ReadPage returns page pageNum (1-based). The returned data is shared with the
+// cache and must not be modified.
+func (p *Pager) ReadPage(pageNum int) (*Page, error) {
+	if pageNum < 1 {
+		return nil, fmt.Errorf("invalid page number %d", pageNum)
+	}
+	if page, ok := p.cache.get(pageNum); ok {
+		return page, nil
+	}
+
+	data := make([]byte, p.pageSize)
+	offset := int64(pageNum-1) * int64(p.pageSize)
+	if _, err := p.file.ReadAt(data, offset); err != nil {
+		return nil, fmt.Errorf("failed to read page %d: %w", pageNum, err)
+	}
+
+	page := &Page{Number: pageNum, Data: data}
+	p.cache.put(page)
+	return page, nil
+}
+
+// ReadBTreePage returns page pageNum with its B-tree header decoded.
+func (p *Pager) ReadBTreePage(pageNum int) (*Page, error) {
+	page, err := p.ReadPage(pageNum)
+	if err != nil {
+		return nil, err
+	}
+	if page.Header == nil {
+		pH, err := DecodePageHeader(page.Data, pageNum)
+		if err != nil {
+			return nil, err
+		}
+		page.Header = &pH
+	}
+	return page, nil
+}
+
+func (p *Pager) Close() error {
+	p.cache.clear()
+	return p.file.Close()
+}
+
+type pageCache struct {
+	capacity int
+	order    *list.List // front is the most recently used page
+	entries  map[int]*list.Element
+}
+
+func newPageCache(capacity int) *pageCache {
+	if capacity <= 0 {
+		capacity = defaultPageCacheSize
+	}
+	return &pageCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[int]*list.Element, capacity),
+	}
+}
+
+func (c *pageCache) get(pageNum int) (*Page, bool) {
+	elem, ok := c.entries[pageNum]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*Page), true
+}
+
+func (c *pageCache) put(page *Page) {
+	if elem, ok := c.entries[page.Number]; ok {
+		elem.Value = page
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[page.Number] = c.order.PushFront(page)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*Page).Number)
+	}
+}
+
+func (c *pageCache) clear() {
+	c.order.Init()
+	c.entries = make(map[int]*list.Element, c.capacity)
+}
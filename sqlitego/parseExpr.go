@@ -0,0 +1,516 @@
+package sqlitego
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var errHexTooBig = errors.New("hex literal too big")
+
+// Expressions are parsed by recursive descent, one method per precedence level
+// from lowest (OR) to highest (unary operators).
+
+func (p *parser) expr() (Expr, error) {
+	return p.orExpr()
+}
+
+func (p *parser) orExpr() (Expr, error) {
+	left, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) andExpr() (Expr, error) {
+	left, err := p.notExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.notExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) notExpr() (Expr, error) {
+	if p.acceptKeyword("NOT") {
+		operand, err := p.notExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "NOT", Operand: operand}, nil
+	}
+	return p.equalityExpr()
+}
+
+// equalityExpr reads the operators that share SQLite's equality precedence:
+// =, ==, !=, <>, IS [NOT], [NOT] BETWEEN, [NOT] IN, [NOT] LIKE, [NOT] GLOB,
+// ISNULL, NOTNULL and NOT NULL.
+func (p *parser) equalityExpr() (Expr, error) {
+	left, err := p.relationalExpr()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.atKeyword("BETWEEN") || p.atKeyword("NOT", "BETWEEN"):
+			if left, err = p.betweenExpr(left); err != nil {
+				return nil, err
+			}
+			continue
+		case p.atKeyword("IN") || p.atKeyword("NOT", "IN"):
+			if left, err = p.inExpr(left); err != nil {
+				return nil, err
+			}
+			continue
+		case p.atKeyword("LIKE") || p.atKeyword("GLOB") || p.atKeyword("NOT", "LIKE") || p.atKeyword("NOT", "GLOB"):
+			if left, err = p.likeExpr(left); err != nil {
+				return nil, err
+			}
+			continue
+		case p.acceptKeyword("ISNULL"):
+			left = &BinaryExpr{Op: "IS", Left: left, Right: &Literal{Value: NullValue()}}
+			continue
+		case p.acceptKeyword("NOTNULL") || p.acceptKeyword("NOT", "NULL"):
+			left = &BinaryExpr{Op: "IS NOT", Left: left, Right: &Literal{Value: NullValue()}}
+			continue
+		case p.acceptKeyword("IS"):
+			not := p.acceptKeyword("NOT")
+			if p.acceptKeyword("DISTINCT", "FROM") {
+				not = !not
+			}
+			right, err := p.relationalExpr()
+			if err != nil {
+				return nil, err
+			}
+			op := "IS"
+			if not {
+				op = "IS NOT"
+			}
+			left = &BinaryExpr{Op: op, Left: left, Right: right}
+			continue
+		}
+		op, ok := p.acceptOperator("=", "==", "!=", "<>")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.relationalExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+// inExpr reads "[NOT] IN (list)" or "[NOT] IN (SELECT ...)" after its left
+// operand.
+func (p *parser) inExpr(left Expr) (Expr, error) {
+	in := &InExpr{Expr: left, Not: p.acceptKeyword("NOT")}
+	p.next() // IN
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	if p.atSelect() {
+		var err error
+		if in.Select, err = p.selectStmt(); err != nil {
+			return nil, err
+		}
+		return in, p.expectOp(")")
+	}
+	for !p.atOp(")") {
+		item, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		in.List = append(in.List, item)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	return in, p.expectOp(")")
+}
+
+// likeExpr reads "[NOT] LIKE pattern [ESCAPE escape]" or "[NOT] GLOB pattern"
+// after its left operand.
+func (p *parser) likeExpr(left Expr) (Expr, error) {
+	like := &LikeExpr{Expr: left, Not: p.acceptKeyword("NOT")}
+	like.Op = strings.ToUpper(p.next().text)
+	var err error
+	if like.Pattern, err = p.relationalExpr(); err != nil {
+		return nil, err
+	}
+	if like.Op == "LIKE" && p.acceptKeyword("ESCAPE") {
+		if like.Escape, err = p.relationalExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return like, nil
+}
+
+// betweenExpr reads "[NOT] BETWEEN low AND high" after its left operand. The
+// bounds bind tighter than AND, so the AND is never taken as a conjunction.
+func (p *parser) betweenExpr(left Expr) (Expr, error) {
+	between := &BetweenExpr{Expr: left, Not: p.acceptKeyword("NOT")}
+	p.next() // BETWEEN
+	var err error
+	if between.Low, err = p.relationalExpr(); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AND"); err != nil {
+		return nil, err
+	}
+	if between.High, err = p.relationalExpr(); err != nil {
+		return nil, err
+	}
+	return between, nil
+}
+
+func (p *parser) relationalExpr() (Expr, error) {
+	return p.binaryLevel(p.bitExpr, "<", "<=", ">", ">=")
+}
+
+func (p *parser) bitExpr() (Expr, error) {
+	return p.binaryLevel(p.additiveExpr, "&", "|", "<<", ">>")
+}
+
+func (p *parser) additiveExpr() (Expr, error) {
+	return p.binaryLevel(p.multiplicativeExpr, "+", "-")
+}
+
+func (p *parser) multiplicativeExpr() (Expr, error) {
+	return p.binaryLevel(p.concatExpr, "*", "/", "%")
+}
+
+func (p *parser) concatExpr() (Expr, error) {
+	return p.binaryLevel(p.collateExpr, "||")
+}
+
+// binaryLevel reads a left-associative chain of the operators ops, whose
+// operands are read by operand.
+func (p *parser) binaryLevel(operand func() (Expr, error), ops ...string) (Expr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOperator(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+// collateExpr reads any number of postfix "COLLATE name" operators, which bind
+// tighter than every binary operator.
+func (p *parser) collateExpr() (Expr, error) {
+	expr, err := p.unaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("COLLATE") {
+		name, err := p.identifier("collation name", nil)
+		if err != nil {
+			return nil, err
+		}
+		expr = &CollateExpr{Expr: expr, Collation: name}
+	}
+	return expr, nil
+}
+
+// acceptOperator consumes the next token if it is one of ops and returns it in
+// normalized form.
+func (p *parser) acceptOperator(ops ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.next()
+			switch op {
+			case "==":
+				return "=", true
+			case "<>":
+				return "!=", true
+			}
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) unaryExpr() (Expr, error) {
+	op, ok := p.acceptOperator("-", "+", "~")
+	if !ok {
+		return p.primaryExpr()
+	}
+	if tok := p.peek(); op == "-" && tok.kind == tokNumber && tok.text == "9223372036854775808" {
+		// The one integer literal that only fits once negated.
+		p.next()
+		return &Literal{Value: IntegerValue(math.MinInt64)}, nil
+	}
+	operand, err := p.unaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &UnaryExpr{Op: op, Operand: operand}, nil
+}
+
+func (p *parser) primaryExpr() (Expr, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		v, err := numberLiteral(tok.text)
+		if err != nil {
+			return nil, p.errorf(tok, err.Error())
+		}
+		return &Literal{Value: v}, nil
+	case tokString:
+		p.next()
+		return &Literal{Value: TextValue(tok.text)}, nil
+	case tokBlob:
+		p.next()
+		b, err := hex.DecodeString(tok.text)
+		if err != nil {
+			return nil, p.errorf(tok, "malformed blob literal")
+		}
+		return &Literal{Value: BlobValue(b)}, nil
+	case tokVariable:
+		p.next()
+		return p.param(tok)
+	case tokOp:
+		if tok.text == "(" {
+			p.next()
+			if p.atSelect() {
+				sub, err := p.selectStmt()
+				if err != nil {
+					return nil, err
+				}
+				return &SubqueryExpr{Select: sub}, p.expectOp(")")
+			}
+			expr, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return expr, p.expectOp(")")
+		}
+	case tokIdent:
+		switch {
+		case isKeyword(tok, "NULL"):
+			p.next()
+			return &Literal{Value: NullValue()}, nil
+		case isKeyword(tok, "CASE"):
+			return p.caseExpr()
+		case isKeyword(tok, "CAST") && p.peekAt(1).kind == tokOp && p.peekAt(1).text == "(":
+			return p.castExpr()
+		case isKeyword(tok, "EXISTS") && p.peekAt(1).kind == tokOp && p.peekAt(1).text == "(":
+			p.next()
+			p.next() // "("
+			sub, err := p.selectStmt()
+			if err != nil {
+				return nil, err
+			}
+			return &ExistsExpr{Select: sub}, p.expectOp(")")
+		}
+		if tok.quote == 0 && reservedKeywords[strings.ToUpper(tok.text)] {
+			break
+		}
+		if next := p.peekAt(1); next.kind == tokOp && next.text == "(" {
+			return p.funcCall()
+		}
+		return p.columnRef()
+	}
+	if tok.kind == tokEOF {
+		return nil, p.errorf(tok, "incomplete input, expected an expression")
+	}
+	return nil, p.errorf(tok, "expected an expression")
+}
+
+// caseExpr reads "CASE [operand] WHEN ... THEN ... [ELSE result] END".
+func (p *parser) caseExpr() (Expr, error) {
+	p.next() // CASE
+	e := &CaseExpr{}
+	var err error
+	if !p.atKeyword("WHEN") {
+		if e.Operand, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	for p.acceptKeyword("WHEN") {
+		var when WhenClause
+		if when.When, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		if when.Then, err = p.expr(); err != nil {
+			return nil, err
+		}
+		e.Whens = append(e.Whens, when)
+	}
+	if len(e.Whens) == 0 {
+		return nil, p.errorf(p.peek(), "expected WHEN")
+	}
+	if p.acceptKeyword("ELSE") {
+		if e.Else, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	return e, p.expectKeyword("END")
+}
+
+// castExpr reads "CAST(expr AS type)".
+func (p *parser) castExpr() (Expr, error) {
+	p.next() // CAST
+	p.next() // "("
+	e := &CastExpr{}
+	var err error
+	if e.Expr, err = p.expr(); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+	if e.Type, err = p.typeName(nil); err != nil {
+		return nil, err
+	}
+	return e, p.expectOp(")")
+}
+
+// maxParamNumber is the largest "?NNN" SQLite accepts by default.
+const maxParamNumber = 32766
+
+// param numbers a bind parameter the way SQLite does: "?NNN" takes NNN, a named
+// parameter reuses the number of an earlier one with the same name, and
+// anything else takes one more than the largest number so far.
+func (p *parser) param(tok token) (Expr, error) {
+	param := &Param{}
+	next := 1
+	for _, prev := range p.params {
+		next = max(next, prev.Index+1)
+	}
+	switch {
+	case tok.text == "?":
+		param.Index = next
+	case tok.text[0] == '?':
+		n, err := strconv.Atoi(tok.text[1:])
+		if err != nil || n < 1 || n > maxParamNumber {
+			return nil, p.errorf(tok, fmt.Sprintf("variable number must be between ?1 and ?%d", maxParamNumber))
+		}
+		param.Name, param.Index = tok.text, n
+	default:
+		param.Name, param.Index = tok.text, next
+		for _, prev := range p.params {
+			if prev.Name == tok.text {
+				param.Index = prev.Index
+				break
+			}
+		}
+	}
+	p.params = append(p.params, param)
+	return param, nil
+}
+
+// columnRef reads "column", "table.column" or "schema.table.column".
+func (p *parser) columnRef() (Expr, error) {
+	first := p.next()
+	ref := &ColumnRef{Column: first.text, DoubleQuoted: first.quote == '"'}
+	for i := 0; i < 2 && p.acceptOp("."); i++ {
+		tok := p.peek()
+		if tok.kind != tokIdent {
+			return nil, p.errorf(tok, "expected a column name")
+		}
+		p.next()
+		ref.Table, ref.Column, ref.DoubleQuoted = ref.Column, tok.text, false
+	}
+	return ref, nil
+}
+
+func (p *parser) funcCall() (Expr, error) {
+	call := &FuncCall{Name: p.next().text}
+	p.next() // "("
+	switch {
+	case p.acceptOp("*"):
+		call.Star = true
+	case p.atOp(")"):
+	default:
+		if call.Distinct = p.acceptKeyword("DISTINCT"); p.atOp(")") {
+			break
+		}
+		for {
+			arg, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+	// OVER followed by neither "(" nor a window name is an alias.
+	next := p.peekAt(1)
+	isName := next.kind == tokIdent && (next.quote != 0 || !reservedKeywords[strings.ToUpper(next.text)])
+	if !p.atKeyword("OVER") || !isName && !(next.kind == tokOp && next.text == "(") {
+		return call, nil
+	}
+	p.next()
+	if !p.acceptOp("(") {
+		var err error
+		call.Window, err = p.identifier("window name", reservedKeywords)
+		return call, err
+	}
+	var err error
+	if call.Over, err = p.windowSpec(); err != nil {
+		return nil, err
+	}
+	return call, p.expectOp(")")
+}
+
+// numberLiteral converts the text of a numeric token. Decimal integers too large
+// for 64 bits become REAL; hex literals are 64-bit two's complement.
+func numberLiteral(text string) (Value, error) {
+	if strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X") {
+		u, err := strconv.ParseUint(text[2:], 16, 64)
+		if err != nil {
+			return Value{}, errHexTooBig
+		}
+		return IntegerValue(int64(u)), nil
+	}
+	if !strings.ContainsAny(text, ".eE") {
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return IntegerValue(i), nil
+		}
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil && !isRangeError(err) {
+		return Value{}, err
+	}
+	return RealValue(f), nil
+}
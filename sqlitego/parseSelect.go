@@ -0,0 +1,568 @@
+package sqlitego
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reservedKeywords are the keywords SQLite never accepts as a bare identifier.
+var reservedKeywords = map[string]bool{
+	"ADD": true, "ALL": true, "ALTER": true, "AND": true, "AS": true, "AUTOINCREMENT": true,
+	"BETWEEN": true, "CASE": true, "CHECK": true, "COLLATE": true, "COMMIT": true,
+	"CONSTRAINT": true, "CREATE": true, "DEFAULT": true, "DEFERRABLE": true, "DELETE": true,
+	"DISTINCT": true, "DROP": true, "ELSE": true, "ESCAPE": true, "EXCEPT": true, "EXISTS": true,
+	"FOREIGN": true, "FROM": true, "GROUP": true, "HAVING": true, "IN": true, "INDEX": true,
+	"INSERT": true, "INTERSECT": true, "INTO": true, "IS": true, "ISNULL": true, "JOIN": true,
+	"LIMIT": true, "NOT": true, "NOTHING": true, "NOTNULL": true, "NULL": true, "ON": true,
+	"ORDER": true, "PRIMARY": true, "REFERENCES": true, "RETURNING": true, "SELECT": true,
+	"SET": true, "TABLE": true, "THEN": true, "TO": true, "TRANSACTION": true, "UNION": true,
+	"UNIQUE": true, "UPDATE": true, "USING": true, "VALUES": true, "WHEN": true, "WHERE": true,
+}
+
+// joinKeywords may name a column but cannot be an implicit alias, so that
+// "FROM a LEFT JOIN b" does not read LEFT as the alias of a.
+var joinKeywords = map[string]bool{
+	"CROSS": true, "FULL": true, "INNER": true, "LEFT": true, "NATURAL": true, "OUTER": true, "RIGHT": true,
+}
+
+// parseStatement parses a single SQL statement with an optional trailing ";". It
+// also returns the bind parameters of the statement, in the order they appear.
+func parseStatement(sql string) (Statement, []*Param, error) {
+	p, err := newParser(sql)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.peek().kind == tokEOF {
+		return nil, nil, p.errorf(p.peek(), "empty statement")
+	}
+	if !p.atSelect() {
+		return nil, nil, p.errorf(p.peek(), "only SELECT statements are supported")
+	}
+	stmt, err := p.selectStmt()
+	if err != nil {
+		return nil, nil, err
+	}
+	p.acceptOp(";")
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, nil, p.errorf(tok, "unexpected text after end of statement")
+	}
+	return stmt, p.params, nil
+}
+
+// atSelect reports whether a SELECT, or the WITH clause before one, comes next.
+func (p *parser) atSelect() bool {
+	return p.atKeyword("SELECT") || p.atKeyword("WITH")
+}
+
+func (p *parser) selectStmt() (*SelectStmt, error) {
+	var with *WithClause
+	if p.atKeyword("WITH") {
+		var err error
+		if with, err = p.withClause(); err != nil {
+			return nil, err
+		}
+	}
+	stmt, err := p.selectCore()
+	if err != nil {
+		return nil, err
+	}
+	stmt.With = with
+	for {
+		op := p.compoundOperator()
+		if op == "" {
+			break
+		}
+		part, err := p.selectCore()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Compound = append(stmt.Compound, CompoundSelect{Op: op, Select: part})
+	}
+	if p.acceptKeyword("ORDER", "BY") {
+		for {
+			term, err := p.orderingTerm()
+			if err != nil {
+				return nil, err
+			}
+			stmt.OrderBy = append(stmt.OrderBy, term)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("LIMIT") {
+		limit, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Limit = limit
+		switch {
+		case p.acceptKeyword("OFFSET"):
+			if stmt.Offset, err = p.expr(); err != nil {
+				return nil, err
+			}
+		case p.acceptOp(","):
+			// "LIMIT offset, count" lists the offset first.
+			stmt.Offset = stmt.Limit
+			if stmt.Limit, err = p.expr(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if tok := p.peek(); stmt.OrderBy != nil || stmt.Limit != nil {
+		if op := p.compoundOperator(); op != "" {
+			clause := "ORDER BY"
+			if stmt.OrderBy == nil {
+				clause = "LIMIT"
+			}
+			return nil, p.errorf(tok, fmt.Sprintf("%s clause should come after %s not before", clause, op))
+		}
+	}
+	return stmt, nil
+}
+
+// withClause reads "WITH [RECURSIVE] name [(columns)] AS [[NOT] MATERIALIZED]
+// (SELECT ...), ...". The MATERIALIZED hints change nothing here.
+func (p *parser) withClause() (*WithClause, error) {
+	p.next() // WITH
+	with := &WithClause{Recursive: p.acceptKeyword("RECURSIVE")}
+	for {
+		name, err := p.identifier("table name", reservedKeywords)
+		if err != nil {
+			return nil, err
+		}
+		table := &CommonTable{Name: name}
+		if p.acceptOp("(") {
+			for {
+				col, err := p.identifier("column name", reservedKeywords)
+				if err != nil {
+					return nil, err
+				}
+				table.Columns = append(table.Columns, col)
+				if !p.acceptOp(",") {
+					break
+				}
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expectKeyword("AS"); err != nil {
+			return nil, err
+		}
+		if !p.acceptKeyword("NOT", "MATERIALIZED") {
+			p.acceptKeyword("MATERIALIZED")
+		}
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		if table.Select, err = p.selectStmt(); err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		with.Tables = append(with.Tables, table)
+		if !p.acceptOp(",") {
+			return with, nil
+		}
+	}
+}
+
+// compoundOperator reads UNION, UNION ALL, INTERSECT or EXCEPT if one comes
+// next.
+func (p *parser) compoundOperator() string {
+	switch {
+	case p.acceptKeyword("UNION", "ALL"):
+		return "UNION ALL"
+	case p.acceptKeyword("UNION"):
+		return "UNION"
+	case p.acceptKeyword("INTERSECT"):
+		return "INTERSECT"
+	case p.acceptKeyword("EXCEPT"):
+		return "EXCEPT"
+	}
+	return ""
+}
+
+// selectCore reads a SELECT up to its GROUP BY and HAVING clauses.
+func (p *parser) selectCore() (*SelectStmt, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	stmt := &SelectStmt{}
+	if p.acceptKeyword("DISTINCT") {
+		stmt.Distinct = true
+	} else {
+		p.acceptKeyword("ALL")
+	}
+	for {
+		col, err := p.resultColumn()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = append(stmt.Columns, col)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+
+	if p.acceptKeyword("FROM") {
+		var err error
+		if stmt.From, err = p.fromClause(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("WHERE") {
+		where, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Where = where
+	}
+	if p.acceptKeyword("GROUP", "BY") {
+		var err error
+		if stmt.GroupBy, err = p.exprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("HAVING") {
+		having, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Having = having
+	}
+	if p.acceptKeyword("WINDOW") {
+		for {
+			name, err := p.identifier("window name", reservedKeywords)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectKeyword("AS"); err != nil {
+				return nil, err
+			}
+			if err := p.expectOp("("); err != nil {
+				return nil, err
+			}
+			spec, err := p.windowSpec()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			stmt.Windows = append(stmt.Windows, NamedWindow{Name: name, Spec: spec})
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+	return stmt, nil
+}
+
+// fromClause reads the tables of FROM and the joins between them.
+func (p *parser) fromClause() ([]*TableRef, error) {
+	var from []*TableRef
+	join := ""
+	natural := false
+	for {
+		ref, err := p.tableRef()
+		if err != nil {
+			return nil, err
+		}
+		ref.Join, ref.Natural = join, natural
+		if join != "" {
+			if err := p.joinConstraint(ref); err != nil {
+				return nil, err
+			}
+		}
+		from = append(from, ref)
+		if p.acceptOp(",") {
+			join, natural = ",", false
+			continue
+		}
+		ok := false
+		if join, natural, ok, err = p.joinOperator(); err != nil {
+			return nil, err
+		}
+		if !ok {
+			return from, nil
+		}
+	}
+}
+
+// tableRef reads a table name or a "(SELECT ...)" subquery, with an optional
+// alias.
+func (p *parser) tableRef() (*TableRef, error) {
+	ref := &TableRef{}
+	var err error
+	if p.atOp("(") {
+		p.next()
+		if !p.atSelect() {
+			return nil, p.errorf(p.peek(), "expected a subquery")
+		}
+		if ref.Subquery, err = p.selectStmt(); err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+	} else if ref.Name, err = p.qualifiedName("table name"); err != nil {
+		return nil, err
+	}
+	if ref.Alias, err = p.alias(); err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// joinOperator reads "[NATURAL] [LEFT [OUTER] | INNER | CROSS] JOIN", reporting
+// false when no join follows.
+func (p *parser) joinOperator() (join string, natural bool, ok bool, err error) {
+	start := p.peek()
+	var words []string
+	for p.peek().kind == tokIdent && p.peek().quote == 0 && joinKeywords[strings.ToUpper(p.peek().text)] {
+		words = append(words, strings.ToUpper(p.next().text))
+	}
+	if !p.acceptKeyword("JOIN") {
+		if len(words) == 0 {
+			return "", false, false, nil
+		}
+		return "", false, false, p.errorf(p.peek(), "expected JOIN")
+	}
+	if len(words) > 0 && words[0] == "NATURAL" {
+		natural, words = true, words[1:]
+	}
+	switch strings.Join(words, " ") {
+	case "", "INNER":
+		join = "INNER"
+	case "LEFT", "LEFT OUTER":
+		join = "LEFT"
+	case "CROSS":
+		join = "CROSS"
+	case "RIGHT", "RIGHT OUTER", "FULL", "FULL OUTER":
+		return "", false, false, fmt.Errorf("RIGHT and FULL OUTER JOINs are not supported")
+	default:
+		return "", false, false, fmt.Errorf("unknown join type: %s", strings.TrimSpace(p.sql[start.pos:p.toks[p.pos-1].pos]))
+	}
+	return join, natural, true, nil
+}
+
+// joinConstraint reads the optional "ON expr" or "USING (columns)" of a join.
+func (p *parser) joinConstraint(ref *TableRef) error {
+	switch {
+	case p.acceptKeyword("ON"):
+		on, err := p.expr()
+		if err != nil {
+			return err
+		}
+		ref.On = on
+	case p.acceptKeyword("USING"):
+		if err := p.expectOp("("); err != nil {
+			return err
+		}
+		for {
+			name, err := p.identifier("column name", nil)
+			if err != nil {
+				return err
+			}
+			ref.Using = append(ref.Using, name)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		if err := p.expectOp(")"); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	if ref.Natural {
+		return fmt.Errorf("a NATURAL join may not have an ON or USING clause")
+	}
+	return nil
+}
+
+// orderingTerm reads "expr [ASC|DESC] [NULLS FIRST|LAST]".
+func (p *parser) orderingTerm() (OrderingTerm, error) {
+	expr, err := p.expr()
+	if err != nil {
+		return OrderingTerm{}, err
+	}
+	term := OrderingTerm{Expr: expr}
+	if !p.acceptKeyword("ASC") {
+		term.Desc = p.acceptKeyword("DESC")
+	}
+	if p.acceptKeyword("NULLS") {
+		switch {
+		case p.acceptKeyword("FIRST"):
+			term.Nulls = "FIRST"
+		case p.acceptKeyword("LAST"):
+			term.Nulls = "LAST"
+		default:
+			return OrderingTerm{}, p.errorf(p.peek(), "expected FIRST or LAST")
+		}
+	}
+	return term, nil
+}
+
+// windowSpec reads the definition of a window between its parentheses:
+// "[base] [PARTITION BY exprs] [ORDER BY terms] [frame]".
+func (p *parser) windowSpec() (*WindowSpec, error) {
+	spec := &WindowSpec{}
+	if tok := p.peek(); tok.kind == tokIdent && (tok.quote != 0 || !p.atKeyword("PARTITION") && !p.atKeyword("ORDER") && !p.atFrameUnits()) {
+		p.next()
+		spec.Base = tok.text
+	}
+	if p.acceptKeyword("PARTITION", "BY") {
+		var err error
+		if spec.PartitionBy, err = p.exprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("ORDER", "BY") {
+		for {
+			term, err := p.orderingTerm()
+			if err != nil {
+				return nil, err
+			}
+			spec.OrderBy = append(spec.OrderBy, term)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+	if p.atFrameUnits() {
+		var err error
+		if spec.Frame, err = p.frameSpec(); err != nil {
+			return nil, err
+		}
+	}
+	return spec, nil
+}
+
+func (p *parser) atFrameUnits() bool {
+	return p.atKeyword("ROWS") || p.atKeyword("RANGE") || p.atKeyword("GROUPS")
+}
+
+// frameSpec reads "ROWS|RANGE|GROUPS BETWEEN start AND end [EXCLUDE ...]", or
+// "ROWS|RANGE|GROUPS start [EXCLUDE ...]", which ends at the current row.
+func (p *parser) frameSpec() (*FrameSpec, error) {
+	frame := &FrameSpec{Units: strings.ToUpper(p.next().text), End: FrameBound{Kind: "CURRENT ROW"}}
+	between := p.acceptKeyword("BETWEEN")
+	var err error
+	if frame.Start, err = p.frameBound(false); err != nil {
+		return nil, err
+	}
+	if between {
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		if frame.End, err = p.frameBound(true); err != nil {
+			return nil, err
+		}
+	}
+	// The frame may not end before it starts.
+	order := map[string]int{"PRECEDING": 1, "CURRENT ROW": 2, "FOLLOWING": 3}
+	if order[frame.Start.Kind] > order[frame.End.Kind] && frame.End.Kind != "UNBOUNDED FOLLOWING" {
+		return nil, fmt.Errorf("unsupported frame specification")
+	}
+	if p.acceptKeyword("EXCLUDE") {
+		switch {
+		case p.acceptKeyword("NO", "OTHERS"):
+		case p.acceptKeyword("CURRENT", "ROW"):
+			frame.Exclude = "CURRENT ROW"
+		case p.acceptKeyword("GROUP"):
+			frame.Exclude = "GROUP"
+		case p.acceptKeyword("TIES"):
+			frame.Exclude = "TIES"
+		default:
+			return nil, p.errorf(p.peek(), "expected NO OTHERS, CURRENT ROW, GROUP or TIES")
+		}
+	}
+	return frame, nil
+}
+
+// frameBound reads one end of a frame. UNBOUNDED PRECEDING may only start a
+// frame and UNBOUNDED FOLLOWING only end one.
+func (p *parser) frameBound(end bool) (FrameBound, error) {
+	tok := p.peek()
+	switch {
+	case p.acceptKeyword("CURRENT", "ROW"):
+		return FrameBound{Kind: "CURRENT ROW"}, nil
+	case !end && p.acceptKeyword("UNBOUNDED", "PRECEDING"):
+		return FrameBound{Kind: "UNBOUNDED PRECEDING"}, nil
+	case end && p.acceptKeyword("UNBOUNDED", "FOLLOWING"):
+		return FrameBound{Kind: "UNBOUNDED FOLLOWING"}, nil
+	case p.atKeyword("UNBOUNDED"):
+		return FrameBound{}, p.errorf(p.peekAt(1), "expected a frame bound")
+	}
+	offset, err := p.expr()
+	if err != nil {
+		return FrameBound{}, err
+	}
+	switch {
+	case p.acceptKeyword("PRECEDING"):
+		return FrameBound{Kind: "PRECEDING", Offset: offset}, nil
+	case p.acceptKeyword("FOLLOWING"):
+		return FrameBound{Kind: "FOLLOWING", Offset: offset}, nil
+	}
+	return FrameBound{}, p.errorf(tok, "expected PRECEDING or FOLLOWING")
+}
+
+// exprList reads one or more comma-separated expressions.
+func (p *parser) exprList() ([]Expr, error) {
+	var list []Expr
+	for {
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, expr)
+		if !p.acceptOp(",") {
+			return list, nil
+		}
+	}
+}
+
+func (p *parser) resultColumn() (ResultColumn, error) {
+	if p.acceptOp("*") {
+		return ResultColumn{Star: true, Text: "*"}, nil
+	}
+	start := p.peek()
+	if dot, star := p.peekAt(1), p.peekAt(2); start.kind == tokIdent && dot.kind == tokOp && dot.text == "." && star.kind == tokOp && star.text == "*" {
+		p.pos += 3
+		return ResultColumn{Star: true, Table: start.text, Text: p.textFrom(start)}, nil
+	}
+	expr, err := p.expr()
+	if err != nil {
+		return ResultColumn{}, err
+	}
+	col := ResultColumn{Expr: expr, Text: p.textFrom(start)}
+	if col.Alias, err = p.alias(); err != nil {
+		return ResultColumn{}, err
+	}
+	return col, nil
+}
+
+// alias reads an optional "[AS] name". Without AS, only a word that cannot start
+// the next clause is taken as the alias.
+func (p *parser) alias() (string, error) {
+	if p.acceptKeyword("AS") {
+		return p.identifier("alias", reservedKeywords)
+	}
+	tok := p.peek()
+	switch {
+	case tok.kind == tokString:
+		p.next()
+		return tok.text, nil
+	case isKeyword(tok, "WINDOW") && isKeyword(p.peekAt(2), "AS"):
+		// "WINDOW name AS (...)" starts the WINDOW clause.
+		return "", nil
+	case tok.kind == tokIdent && (tok.quote != 0 || !reservedKeywords[strings.ToUpper(tok.text)] && !joinKeywords[strings.ToUpper(tok.text)]):
+		p.next()
+		return tok.text, nil
+	}
+	return "", nil
+}
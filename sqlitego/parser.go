@@ -0,0 +1,141 @@
+package sqlitego
+
+import (
+	"strings"
+)
+
+// parser walks the token stream of a single statement.
+type parser struct {
+	sql    string
+	toks   []token
+	pos    int
+	params []*Param // bind parameters in the order they appear
+}
+
+func newParser(sql string) (*parser, error) {
+	toks, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{sql: sql, toks: toks}, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	tok := p.toks[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(tok token, msg string) error {
+	return &SyntaxError{SQL: p.sql, Pos: tok.pos, Near: p.sql[tok.pos:tok.end], Msg: msg}
+}
+
+func isKeyword(tok token, keyword string) bool {
+	return tok.kind == tokIdent && tok.quote == 0 && strings.EqualFold(tok.text, keyword)
+}
+
+func (p *parser) atKeyword(keywords ...string) bool {
+	for i, keyword := range keywords {
+		if !isKeyword(p.peekAt(i), keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+// acceptKeyword consumes the keyword sequence if it comes next.
+func (p *parser) acceptKeyword(keywords ...string) bool {
+	if !p.atKeyword(keywords...) {
+		return false
+	}
+	p.pos += len(keywords)
+	return true
+}
+
+func (p *parser) expectKeyword(keywords ...string) error {
+	for _, keyword := range keywords {
+		if !isKeyword(p.peek(), keyword) {
+			return p.errorf(p.peek(), "expected "+keyword)
+		}
+		p.next()
+	}
+	return nil
+}
+
+func (p *parser) atOp(op string) bool {
+	tok := p.peek()
+	return tok.kind == tokOp && tok.text == op
+}
+
+func (p *parser) acceptOp(op string) bool {
+	if !p.atOp(op) {
+		return false
+	}
+	p.next()
+	return true
+}
+
+func (p *parser) expectOp(op string) error {
+	if !p.acceptOp(op) {
+		return p.errorf(p.peek(), "expected \""+op+"\"")
+	}
+	return nil
+}
+
+// textFrom returns the source text from start up to the last consumed token.
+func (p *parser) textFrom(start token) string {
+	return p.sql[start.pos:p.toks[p.pos-1].end]
+}
+
+// identifier reads a name. Quoted identifiers are always accepted; bare words
+// are rejected when they are one of the given reserved keywords.
+func (p *parser) identifier(what string, reserved map[string]bool) (string, error) {
+	tok := p.peek()
+	if tok.kind == tokString {
+		// SQLite accepts 'name' where an identifier is expected.
+		p.next()
+		return tok.text, nil
+	}
+	if tok.kind != tokIdent || (tok.quote == 0 && reserved[strings.ToUpper(tok.text)]) {
+		return "", p.errorf(tok, "expected "+what)
+	}
+	p.next()
+	return tok.text, nil
+}
+
+// skipParenthesized consumes a balanced "( ... )" group and returns the source
+// text between the outer parentheses.
+func (p *parser) skipParenthesized() (string, error) {
+	open := p.peek()
+	if err := p.expectOp("("); err != nil {
+		return "", err
+	}
+	depth := 1
+	for {
+		tok := p.next()
+		switch {
+		case tok.kind == tokEOF:
+			return "", p.errorf(open, "unbalanced parentheses")
+		case tok.kind == tokOp && tok.text == "(":
+			depth++
+		case tok.kind == tokOp && tok.text == ")":
+			depth--
+			if depth == 0 {
+				return strings.TrimSpace(p.sql[open.end:tok.pos]), nil
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package sqlitego
+
+// Pattern matching for LIKE and GLOB, following patternCompare in SQLite's
+// func.c. LIKE folds ASCII letters only, as SQLite does without ICU.
+
+// likeMatch reports whether s matches the LIKE pattern: "%" matches any run of
+// characters and "_" exactly one. esc, when not -1, makes the next character of
+// the pattern literal.
+func likeMatch(pattern, s string, esc rune) bool {
+	return matchPattern([]rune(pattern), []rune(s), '%', '_', esc, true)
+}
+
+// globMatch reports whether s matches the GLOB pattern: "*" matches any run of
+// characters, "?" exactly one, and "[...]" one character of a set.
+func globMatch(pattern, s string) bool {
+	return matchPattern([]rune(pattern), []rune(s), '*', '?', -1, false)
+}
+
+func matchPattern(pat, s []rune, many, one, esc rune, fold bool) bool {
+	for len(pat) > 0 {
+		c := pat[0]
+		pat = pat[1:]
+		switch {
+		case c == many:
+			// Collapse runs of wildcards, letting each "one" consume a character.
+			for len(pat) > 0 && (pat[0] == many || pat[0] == one) {
+				if pat[0] == one {
+					if len(s) == 0 {
+						return false
+					}
+					s = s[1:]
+				}
+				pat = pat[1:]
+			}
+			if len(pat) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchPattern(pat, s[i:], many, one, esc, fold) {
+					return true
+				}
+			}
+			return false
+		case c == one:
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+		case c == '[' && !fold:
+			if len(s) == 0 {
+				return false
+			}
+			rest, ok := matchSet(pat, s[0])
+			if !ok {
+				return false
+			}
+			pat, s = rest, s[1:]
+		default:
+			if c == esc {
+				if len(pat) == 0 {
+					return false
+				}
+				c, pat = pat[0], pat[1:]
+			}
+			if len(s) == 0 || !sameRune(c, s[0], fold) {
+				return false
+			}
+			s = s[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// matchSet matches c against the set of a GLOB "[...]" whose opening bracket
+// has been consumed, and returns the pattern after the closing bracket.
+func matchSet(pat []rune, c rune) ([]rune, bool) {
+	invert := len(pat) > 0 && pat[0] == '^'
+	if invert {
+		pat = pat[1:]
+	}
+	seen := false
+	if len(pat) > 0 && pat[0] == ']' {
+		seen = c == ']'
+		pat = pat[1:]
+	}
+	var prior rune = -1
+	for len(pat) > 0 && pat[0] != ']' {
+		if pat[0] == '-' && prior >= 0 && len(pat) > 1 && pat[1] != ']' {
+			if c >= prior && c <= pat[1] {
+				seen = true
+			}
+			prior = -1
+			pat = pat[2:]
+			continue
+		}
+		if c == pat[0] {
+			seen = true
+		}
+		prior = pat[0]
+		pat = pat[1:]
+	}
+	if len(pat) == 0 || seen == invert {
+		return nil, false
+	}
+	return pat[1:], true
+}
+
+func sameRune(a, b rune, fold bool) bool {
+	if a == b {
+		return true
+	}
+	return fold && a < 0x80 && b < 0x80 && asciiLower(byte(a)) == asciiLower(byte(b))
+}
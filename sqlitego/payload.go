@@ -0,0 +1,111 @@
+package sqlitego
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Payloads that do not fit on their B-tree page keep a prefix locally and spill the
+// rest onto a linked list of overflow pages. The thresholds below follow the
+// "Cell Payload Overflow Pages" section of the SQLite file format.
+
+func (p *Pager) maxLocal(isTable bool) int {
+	if isTable {
+		return p.usableSize - 35
+	}
+	return (p.usableSize-12)*64/255 - 23
+}
+
+func (p *Pager) minLocal() int {
+	return (p.usableSize-12)*32/255 - 23
+}
+
+// localPayloadSize returns how many bytes of a payloadSize-byte payload are stored
+// on the B-tree page itself.
+func (p *Pager) localPayloadSize(payloadSize int, isTable bool) int {
+	maxLocal := p.maxLocal(isTable)
+	if payloadSize <= maxLocal {
+		return payloadSize
+	}
+	minLocal := p.minLocal()
+	k := minLocal + (payloadSize-minLocal)%(p.usableSize-4)
+	if k <= maxLocal {
+		return k
+	}
+	return minLocal
+}
+
+// readPayload returns the full payloadSize-byte payload whose local part starts at
+// pos in page, following the overflow chain when needed.
+func (p *Pager) readPayload(page []byte, pos int, payloadSize int, isTable bool) ([]byte, error) {
+	return p.readPayloadPrefix(page, pos, payloadSize, payloadSize, isTable)
+}
+
+// readPayloadPrefix returns the first n bytes of the payload, following the
+// overflow chain only as far as they reach.
+func (p *Pager) readPayloadPrefix(page []byte, pos int, payloadSize int, n int, isTable bool) ([]byte, error) {
+	local := p.localPayloadSize(payloadSize, isTable)
+	if pos+local > len(page) {
+		return nil, fmt.Errorf("cell payload at offset %d overflows the page", pos)
+	}
+	if n <= local {
+		return page[pos : pos+n], nil
+	}
+	if pos+local+4 > len(page) {
+		return nil, fmt.Errorf("cell at offset %d is missing its overflow page pointer", pos)
+	}
+
+	payload := make([]byte, 0, n)
+	payload = append(payload, page[pos:pos+local]...)
+	nextPage := int(binary.BigEndian.Uint32(page[pos+local:]))
+	for len(payload) < n {
+		if nextPage == 0 {
+			return nil, fmt.Errorf("overflow chain ended after %d of %d payload bytes", len(payload), payloadSize)
+		}
+		overflow, err := p.ReadPage(nextPage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read overflow page: %w", err)
+		}
+		// Each overflow page: [next_page (4 bytes)][usableSize-4 bytes of payload]
+		chunk := min(n-len(payload), p.usableSize-4)
+		payload = append(payload, overflow.Data[4:4+chunk]...)
+		nextPage = int(binary.BigEndian.Uint32(overflow.Data[0:4]))
+	}
+	return payload, nil
+}
+
+// readTableLeafCell decodes a table leaf cell: [payload_size][rowid][payload].
+func (p *Pager) readTableLeafCell(page []byte, pos int) (int, Record, error) {
+	return p.readTableLeafColumns(page, pos, -1)
+}
+
+// readTableLeafColumns decodes the first columns values of a table leaf cell, or
+// all of them when columns is negative. Overflow pages are read only as far as
+// those values reach.
+func (p *Pager) readTableLeafColumns(page []byte, pos int, columns int) (int, Record, error) {
+	payloadSize, n := readVarint(page[pos:])
+	pos += n
+	rowid, n := readVarint(page[pos:])
+	pos += n
+
+	rec, err := decodeRecordColumns(func(n int) ([]byte, error) {
+		return p.readPayloadPrefix(page, pos, payloadSize, n, true)
+	}, payloadSize, columns)
+	if err != nil {
+		return 0, Record{}, err
+	}
+	return rowid, rec, nil
+}
+
+// readIndexCell decodes the payload of an index cell: [payload_size][payload]. For
+// interior index cells pos must point past the 4-byte left child pointer.
+func (p *Pager) readIndexCell(page []byte, pos int) (Record, error) {
+	payloadSize, n := readVarint(page[pos:])
+	pos += n
+
+	payload, err := p.readPayload(page, pos, payloadSize, false)
+	if err != nil {
+		return Record{}, err
+	}
+	return decodeRecord(payload)
+}
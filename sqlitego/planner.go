@@ -0,0 +1,557 @@
+package sqlitego
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// indexPlan reads a table through one of its indexes: only the index entries
+// between lower and upper are visited. A nil bound leaves that end open.
+type indexPlan struct {
+	index   *IndexDef
+	root    int
+	columns []indexKeyColumn // ordering of each constrained index column
+	lower   *indexBound
+	upper   *indexBound
+	eq      int // number of leading columns fixed by "=" terms
+	score   int
+}
+
+type indexKeyColumn struct {
+	collation Collation
+	desc      bool
+}
+
+// indexBound limits the leading index columns to key. Bounds are expressed in
+// index order, so on a DESC column a "<" term gives the lower bound.
+type indexBound struct {
+	key       []Value
+	inclusive bool
+}
+
+// indexTerm is a WHERE term comparing a column with a constant, rewritten so the
+// column is on the left.
+type indexTerm struct {
+	colIdx int
+	op     string // "=", "<", "<=", ">" or ">="
+	value  Value
+}
+
+// planIndexAccess picks the index of table that best narrows the rows the WHERE
+// clause can select: as many leading columns as possible fixed by "=" terms,
+// then optionally a range on the next column. It returns nil when no index helps
+// and the table has to be scanned.
+func planIndexAccess(catalog *Catalog, table SchemaEntry, def *TableDef, sc *scope, where Expr) (*indexPlan, error) {
+	terms, err := indexableTerms(where, sc)
+	if err != nil || len(terms) == 0 {
+		return nil, err
+	}
+
+	var best *indexPlan
+	for _, entry := range catalog.IndexesOn(table.Name) {
+		index, err := catalog.IndexDef(entry)
+		if err != nil {
+			return nil, err
+		}
+		if index.Where != "" {
+			// A partial index only holds the rows its own WHERE clause selects.
+			continue
+		}
+		plan, err := planIndex(index, entry.RootPage, def, terms)
+		if err != nil {
+			return nil, err
+		}
+		if plan != nil && (best == nil || plan.score > best.score) {
+			best = plan
+		}
+	}
+	return best, nil
+}
+
+func planIndex(index *IndexDef, root int, def *TableDef, terms []indexTerm) (*indexPlan, error) {
+	plan := &indexPlan{index: index, root: root}
+	var prefix []Value
+	for _, ic := range index.Columns {
+		colIdx := def.ColumnIndex(ic.Name)
+		if ic.Name == "" || colIdx < 0 {
+			break
+		}
+		column := def.Columns[colIdx]
+		// The index only orders values the way the comparison does when both use
+		// the same collation.
+		collName := ic.Collate
+		if collName == "" {
+			collName = column.Collate
+		}
+		if !strings.EqualFold(orBinary(collName), orBinary(column.Collate)) {
+			break
+		}
+		coll, ok := lookupCollation(orBinary(collName))
+		if !ok {
+			return nil, fmt.Errorf("no such collation sequence: %s", collName)
+		}
+		keyColumn := indexKeyColumn{collation: coll, desc: ic.Desc}
+
+		// Index entries hold values after the column's affinity was applied, so
+		// constants are converted the same way the comparison would.
+		var eq, lower, upper *indexTerm
+		for _, t := range terms {
+			if t.colIdx != colIdx {
+				continue
+			}
+			_, t.value = prepareComparison(NullValue(), column.Affinity, t.value, AffinityNone)
+			switch {
+			case t.op == "=" && eq == nil:
+				eq = &t
+			case (t.op == ">" || t.op == ">=") && lower == nil:
+				lower = &t
+			case (t.op == "<" || t.op == "<=") && upper == nil:
+				upper = &t
+			}
+		}
+		if eq != nil {
+			prefix = append(prefix, eq.value)
+			plan.columns = append(plan.columns, keyColumn)
+			plan.eq++
+			plan.score += 4
+			continue
+		}
+		if lower == nil && upper == nil {
+			break
+		}
+		plan.columns = append(plan.columns, keyColumn)
+		if lower == nil {
+			// NULL sorts first but never satisfies a comparison.
+			lower = &indexTerm{op: ">", value: NullValue()}
+		} else {
+			plan.score++
+		}
+		if upper != nil {
+			plan.score++
+		}
+		if ic.Desc {
+			lower, upper = upper, lower
+		}
+		if lower != nil {
+			plan.lower = &indexBound{key: append(slices.Clip(prefix), lower.value), inclusive: lower.op == ">=" || lower.op == "<="}
+		}
+		if upper != nil {
+			plan.upper = &indexBound{key: append(slices.Clip(prefix), upper.value), inclusive: upper.op == ">=" || upper.op == "<="}
+		}
+		return plan, nil
+	}
+	if len(prefix) == 0 {
+		return nil, nil
+	}
+	plan.lower = &indexBound{key: prefix, inclusive: true}
+	plan.upper = plan.lower
+	return plan, nil
+}
+
+// orderColumn is a term of a requested row order that is a plain column of the
+// table.
+type orderColumn struct {
+	col        int
+	desc       bool
+	nullsFirst bool
+}
+
+// tableOrder reports whether a scan of the table in rowid order, backwards when
+// reverse, delivers rows in order.
+func tableOrder(def *TableDef, order []orderColumn) (ok, reverse bool) {
+	if len(order) == 0 || !def.isRowid(order[0].col) {
+		return false, false
+	}
+	// Rowids are unique, so the terms after the first never matter.
+	return true, order[0].desc
+}
+
+// providesOrder reports whether scanning the entries of the plan, backwards
+// when reverse, delivers rows in order. Columns fixed by "=" terms may appear
+// anywhere in the order, and the rowid that ends every index entry may follow
+// the indexed columns. NULLs must sit where the order's direction puts them by
+// default, as that is where the index keeps them.
+func (plan *indexPlan) providesOrder(def *TableDef, order []orderColumn) (ok, reverse bool) {
+	type keyColumn struct {
+		col  int
+		desc bool
+	}
+	var keys []keyColumn
+	for _, ic := range plan.index.Columns {
+		colIdx := def.ColumnIndex(ic.Name)
+		if ic.Name == "" || colIdx < 0 {
+			break
+		}
+		collName := ic.Collate
+		if collName == "" {
+			collName = def.Columns[colIdx].Collate
+		}
+		if !strings.EqualFold(orBinary(collName), orBinary(def.Columns[colIdx].Collate)) {
+			break
+		}
+		keys = append(keys, keyColumn{col: colIdx, desc: ic.Desc})
+	}
+	complete := len(keys) == len(plan.index.Columns)
+
+	fixed := map[int]bool{}
+	for _, key := range keys[:min(plan.eq, len(keys))] {
+		fixed[key.col] = true
+	}
+	pos, directed := plan.eq, false
+	for _, term := range order {
+		if fixed[term.col] {
+			continue
+		}
+		if term.nullsFirst == term.desc {
+			return false, false
+		}
+		var desc, unique bool
+		switch {
+		case pos < len(keys) && keys[pos].col == term.col:
+			desc = keys[pos].desc
+			pos++
+		case complete && pos == len(keys) && def.isRowid(term.col):
+			unique = true
+		default:
+			return false, false
+		}
+		if rev := term.desc != desc; !directed {
+			reverse, directed = rev, true
+		} else if rev != reverse {
+			return false, false
+		}
+		if unique {
+			break
+		}
+	}
+	return true, reverse
+}
+
+// planOrderedIndex looks for an index whose full scan delivers rows in order.
+func planOrderedIndex(catalog *Catalog, table SchemaEntry, def *TableDef, order []orderColumn) (*indexPlan, bool, error) {
+	if len(order) == 0 {
+		return nil, false, nil
+	}
+	for _, entry := range catalog.IndexesOn(table.Name) {
+		index, err := catalog.IndexDef(entry)
+		if err != nil {
+			return nil, false, err
+		}
+		if index.Where != "" {
+			continue
+		}
+		plan := &indexPlan{index: index, root: entry.RootPage}
+		if ok, reverse := plan.providesOrder(def, order); ok {
+			return plan, reverse, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// rowidRange is the set of rowids a scan of a rowid table is narrowed to by
+// the "rowid op value", BETWEEN and IN list terms of a WHERE clause: the rowids
+// of list when in is set, or else those from lower to upper. The WHERE clause is
+// still applied to every row read.
+type rowidRange struct {
+	in           bool
+	list         []int64 // sorted, without duplicates
+	lower, upper int64
+}
+
+// planRowidRange narrows the rowids of def that where can select. It returns nil
+// when no term constrains the rowid.
+func planRowidRange(def *TableDef, sc *scope, where Expr) (*rowidRange, error) {
+	terms, err := indexableTerms(where, sc)
+	if err != nil {
+		return nil, err
+	}
+	r := &rowidRange{lower: math.MinInt64, upper: math.MaxInt64}
+	found, empty := false, false
+	for _, t := range terms {
+		if !def.isRowid(t.colIdx) {
+			continue
+		}
+		_, v := prepareComparison(NullValue(), AffinityInteger, t.value, AffinityNone)
+		if !v.isNumeric() {
+			// Text and blobs sort after every number; the WHERE clause sorts it out.
+			continue
+		}
+		found = true
+		if t.op != "<" && t.op != "<=" {
+			n, ok := lowerRowid(v, t.op == ">")
+			r.lower, empty = max(r.lower, n), empty || !ok
+		}
+		if t.op != ">" && t.op != ">=" {
+			n, ok := upperRowid(v, t.op == "<")
+			r.upper, empty = min(r.upper, n), empty || !ok
+		}
+	}
+	for _, term := range splitConjuncts(where) {
+		list, ok, err := rowidList(def, sc, term)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if r.in {
+			list = slices.DeleteFunc(list, func(n int64) bool { _, ok := slices.BinarySearch(r.list, n); return !ok })
+		}
+		found, r.in, r.list = true, true, list
+	}
+	if !found {
+		return nil, nil
+	}
+	if empty || r.lower > r.upper {
+		return &rowidRange{in: true}, nil
+	}
+	if r.in {
+		r.list = slices.DeleteFunc(r.list, func(n int64) bool { return n < r.lower || n > r.upper })
+	}
+	return r, nil
+}
+
+// rowidList returns the rowids a "rowid IN (list)" term selects, sorted, when
+// every item of the list is known before the scan. Items that no integer
+// equals are left out.
+func rowidList(def *TableDef, sc *scope, term Expr) ([]int64, bool, error) {
+	e, ok := term.(*InExpr)
+	if !ok || e.Not || e.Select != nil {
+		return nil, false, nil
+	}
+	ref, ok := e.Expr.(*ColumnRef)
+	if !ok {
+		return nil, false, nil
+	}
+	idx, err := sc.resolve(ref)
+	if err != nil || idx < 0 || !def.isRowid(idx) {
+		return nil, false, err
+	}
+	list := []int64{}
+	for _, item := range e.List {
+		v, ok := termValue(item, ref, sc, false)
+		if !ok {
+			return nil, false, nil
+		}
+		_, v = prepareComparison(NullValue(), AffinityInteger, v, AffinityNone)
+		switch {
+		case v.Type == TypeInteger:
+			list = append(list, v.Int)
+		case v.Type == TypeReal && v.Real == math.Trunc(v.Real) && v.Real >= -(1<<63) && v.Real < 1<<63:
+			list = append(list, int64(v.Real))
+		}
+	}
+	slices.Sort(list)
+	return slices.Compact(list), true, nil
+}
+
+// lowerRowid returns the least rowid greater than v, or not less than v unless
+// strict. ok is false when there is none.
+func lowerRowid(v Value, strict bool) (int64, bool) {
+	if v.Type == TypeInteger {
+		if strict {
+			return v.Int + 1, v.Int < math.MaxInt64
+		}
+		return v.Int, true
+	}
+	f := math.Ceil(v.Real)
+	if strict && f == v.Real {
+		f++
+	}
+	switch {
+	case f < -(1 << 63):
+		return math.MinInt64, true
+	case f >= 1<<63:
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// upperRowid returns the greatest rowid less than v, or not greater than v
+// unless strict. ok is false when there is none.
+func upperRowid(v Value, strict bool) (int64, bool) {
+	if v.Type == TypeInteger {
+		if strict {
+			return v.Int - 1, v.Int > math.MinInt64
+		}
+		return v.Int, true
+	}
+	f := math.Floor(v.Real)
+	if strict && f == v.Real {
+		f--
+	}
+	switch {
+	case f >= 1<<63:
+		return math.MaxInt64, true
+	case f < -(1 << 63):
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// indexableTerms collects the "column op value" and "column BETWEEN value AND
+// value" terms among the conjuncts of where whose values termValue knows.
+func indexableTerms(where Expr, sc *scope) ([]indexTerm, error) {
+	var terms []indexTerm
+	add := func(ref *ColumnRef, op string, value Value) error {
+		if value.IsNull() {
+			// Comparisons with NULL are never true; the scan sorts it out.
+			return nil
+		}
+		idx, err := sc.resolve(ref)
+		if err == nil && idx >= 0 {
+			terms = append(terms, indexTerm{colIdx: idx, op: op, value: value})
+		}
+		return err
+	}
+	for _, term := range splitConjuncts(where) {
+		switch e := term.(type) {
+		case *BinaryExpr:
+			if ref, op, value, ok := columnComparison(e, sc); ok {
+				if err := add(ref, op, value); err != nil {
+					return nil, err
+				}
+			}
+		case *BetweenExpr:
+			ref, ok := e.Expr.(*ColumnRef)
+			if e.Not || !ok {
+				continue
+			}
+			low, lowOK := termValue(e.Low, ref, sc, false)
+			high, highOK := termValue(e.High, ref, sc, false)
+			if !lowOK || !highOK {
+				continue
+			}
+			if err := add(ref, ">=", low); err != nil {
+				return nil, err
+			}
+			if err := add(ref, "<=", high); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return terms, nil
+}
+
+// mirroredOps gives the operator that keeps a comparison true when its operands
+// are swapped.
+var mirroredOps = map[string]string{"=": "=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+// columnComparison matches "column op value" written either way round, where
+// termValue knows the value, and returns it with the column on the left.
+func columnComparison(e *BinaryExpr, sc *scope) (*ColumnRef, string, Value, bool) {
+	op, ok := mirroredOps[e.Op]
+	if !ok {
+		return nil, "", Value{}, false
+	}
+	if ref, ok := e.Left.(*ColumnRef); ok {
+		if v, ok := termValue(e.Right, ref, sc, false); ok {
+			return ref, e.Op, v, true
+		}
+	}
+	if ref, ok := e.Right.(*ColumnRef); ok {
+		if v, ok := termValue(e.Left, ref, sc, true); ok {
+			return ref, op, v, true
+		}
+	}
+	return nil, "", Value{}, false
+}
+
+// termValue returns the value column ref is compared with when it is known
+// before the scan: a constant or, while a correlated subquery is planned for a
+// row of the query around it, a column of that row. The outer column must leave
+// the comparison to ref as a lookup needs: it must not be numeric when ref is
+// not, and when it is on the left, whose collation decides, it must collate
+// like ref.
+func termValue(other Expr, ref *ColumnRef, sc *scope, left bool) (Value, bool) {
+	if v, ok := constValue(other); ok {
+		return v, true
+	}
+	outerRef, ok := other.(*ColumnRef)
+	if !ok {
+		return Value{}, false
+	}
+	outer, v, ok := sc.outerColumn(outerRef)
+	if !ok {
+		return Value{}, false
+	}
+	idx, err := sc.resolve(ref)
+	if err != nil || idx < 0 {
+		return Value{}, false
+	}
+	column := sc.columns[idx]
+	if outer.Affinity.isNumeric() && !column.Affinity.isNumeric() {
+		return Value{}, false
+	}
+	if left && !sameCollation(outer.Collation, column.Collation) {
+		return Value{}, false
+	}
+	return v, true
+}
+
+// constValue returns the value of a literal or of a bound parameter.
+func constValue(e Expr) (Value, bool) {
+	switch e := e.(type) {
+	case *Literal:
+		return e.Value, true
+	case *Param:
+		return e.Value, true
+	}
+	return Value{}, false
+}
+
+func orBinary(collation string) string {
+	if collation == "" {
+		return "BINARY"
+	}
+	return collation
+}
+
+// splitConjuncts flattens a tree of ANDs into its terms.
+func splitConjuncts(expr Expr) []Expr {
+	if expr == nil {
+		return nil
+	}
+	if e, ok := expr.(*BinaryExpr); ok && e.Op == "AND" {
+		return append(splitConjuncts(e.Left), splitConjuncts(e.Right)...)
+	}
+	return []Expr{expr}
+}
+
+// compareKey compares the leading values of an index entry with key, in index
+// order.
+func (plan *indexPlan) compareKey(values, key []Value) int {
+	for i, k := range key {
+		if i >= len(values) {
+			return -1
+		}
+		c := CompareValues(values[i], k, plan.columns[i].collation)
+		if plan.columns[i].desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// afterLower reports whether an index entry is at or past the lower bound.
+func (plan *indexPlan) afterLower(values []Value) bool {
+	if plan.lower == nil {
+		return true
+	}
+	c := plan.compareKey(values, plan.lower.key)
+	return c > 0 || c == 0 && plan.lower.inclusive
+}
+
+// beforeUpper reports whether an index entry has not yet passed the upper bound.
+func (plan *indexPlan) beforeUpper(values []Value) bool {
+	if plan.upper == nil {
+		return true
+	}
+	c := plan.compareKey(values, plan.upper.key)
+	return c < 0 || c == 0 && plan.upper.inclusive
+}
@@ -0,0 +1,405 @@
+package sqlitego
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formatting of printf() following SQLite's printf.c, which differs from Go's
+// fmt: floats are rounded half away from zero on their decimal digits, "%d"
+// takes a "," flag for thousands separators, "%q", "%Q" and "%w" quote SQL
+// text, and "!" keeps a REAL looking like one.
+
+// decimal is a float split into decimal digits, as sqlite3FpDecode does.
+type decimal struct {
+	neg     bool
+	special string // "Inf" or "NaN"; the other fields are unset
+	digits  []byte // significant digits without trailing zeros; "0" for zero
+	point   int    // position of the decimal point relative to digits
+}
+
+// decodeReal splits r into decimal digits. When round is positive the digits
+// are rounded to that many significant digits; when it is zero or negative,
+// to -round digits after the decimal point. No more than maxDigits digits are
+// kept.
+func decodeReal(r float64, round, maxDigits int) decimal {
+	d := decimal{neg: r < 0}
+	switch s := strconv.FormatFloat(r, 'e', 18, 64); {
+	case r != r:
+		d.special = "NaN"
+		return d
+	case strings.HasSuffix(s, "Inf"):
+		d.special = "Inf"
+		return d
+	case r == 0:
+		d.neg = false
+		d.digits, d.point = []byte("0"), 1
+		return d
+	default:
+		s = strings.TrimPrefix(s, "-")
+		mantissa, exp, _ := strings.Cut(s, "e")
+		e, _ := strconv.Atoi(exp)
+		d.digits = []byte(strings.Replace(mantissa, ".", "", 1))
+		d.point = e + 1
+	}
+	if round <= 0 {
+		round = d.point - round
+		if round == 0 && d.digits[0] >= '5' {
+			// Rounding to just before the first digit may still round up.
+			d.digits = append([]byte{'0'}, d.digits...)
+			d.point++
+			round = 1
+		}
+	}
+	if round > 0 && (round < len(d.digits) || len(d.digits) > maxDigits) {
+		round = min(round, maxDigits)
+		up := d.digits[round] >= '5'
+		d.digits = d.digits[:round]
+		for j := round - 1; up; j-- {
+			if j < 0 {
+				d.digits = append([]byte{'1'}, d.digits...)
+				d.point++
+				break
+			}
+			d.digits[j]++
+			up = d.digits[j] > '9'
+			if up {
+				d.digits[j] = '0'
+			}
+		}
+	}
+	for len(d.digits) > 1 && d.digits[len(d.digits)-1] == '0' {
+		d.digits = d.digits[:len(d.digits)-1]
+	}
+	if round < 0 || len(d.digits) == 0 {
+		d.digits = []byte("0")
+	}
+	return d
+}
+
+// printfSpec is one "%" conversion of a format.
+type printfSpec struct {
+	leftJustify bool
+	plus, space bool
+	alternate   bool // "#"
+	bang        bool // "!"
+	zeroPad     bool
+	thousands   bool // ","
+	width       int
+	precision   int // -1 when not given
+	verb        byte
+}
+
+// formatFloat formats r for the verb f, e, E, g or G.
+func formatFloat(r float64, spec printfSpec) string {
+	precision := spec.precision
+	if precision < 0 {
+		precision = 6
+	}
+	verb := spec.verb | 0x20
+	var round int
+	switch verb {
+	case 'f':
+		round = -precision
+	case 'g':
+		precision = max(precision, 1)
+		round = precision
+	default:
+		round = precision + 1
+	}
+	maxDigits := 16
+	if spec.bang {
+		maxDigits = 26
+	}
+	d := decodeReal(r, round, maxDigits)
+	var prefix string
+	switch {
+	case d.neg:
+		prefix = "-"
+	case spec.plus:
+		prefix = "+"
+	case spec.space:
+		prefix = " "
+	}
+	if d.special == "NaN" {
+		return "NaN"
+	}
+	if d.special == "Inf" {
+		if spec.zeroPad {
+			d.digits, d.point = []byte("9"), 1000
+		} else {
+			return prefix + "Inf"
+		}
+	}
+
+	exp := d.point - 1
+	trimZeros := spec.bang
+	if verb == 'g' {
+		precision--
+		trimZeros = !spec.alternate
+		if exp < -4 || exp > precision {
+			verb = 'e'
+		} else {
+			precision -= exp
+			verb = 'f'
+		}
+	}
+	intDigits := 0
+	if verb == 'f' {
+		intDigits = d.point - 1
+	}
+	var b strings.Builder
+	b.WriteString(prefix)
+	j := 0
+	digit := func() byte {
+		if j < len(d.digits) {
+			j++
+			return d.digits[j-1]
+		}
+		return '0'
+	}
+	if intDigits < 0 {
+		b.WriteByte('0')
+	} else {
+		for e := intDigits; e >= 0; e-- {
+			b.WriteByte(digit())
+			if spec.thousands && e%3 == 0 && e > 1 {
+				b.WriteByte(',')
+			}
+		}
+	}
+	point := precision > 0 || spec.alternate || spec.bang
+	if point {
+		b.WriteByte('.')
+	}
+	for e := intDigits + 1; e < 0 && precision > 0; e++ {
+		b.WriteByte('0')
+		precision--
+	}
+	for ; precision > 0; precision-- {
+		b.WriteByte(digit())
+	}
+	out := b.String()
+	if trimZeros && point {
+		out = strings.TrimRight(out, "0")
+		if strings.HasSuffix(out, ".") {
+			if spec.bang {
+				out += "0"
+			} else {
+				out = out[:len(out)-1]
+			}
+		}
+	}
+	if verb == 'e' {
+		e := 'e'
+		if spec.verb == 'E' || spec.verb == 'G' {
+			e = 'E'
+		}
+		sign := '+'
+		if exp < 0 {
+			sign, exp = '-', -exp
+		}
+		digits := strconv.Itoa(exp)
+		if exp < 10 {
+			digits = "0" + digits
+		}
+		out += string(e) + string(sign) + digits
+	}
+	if spec.zeroPad && !spec.leftJustify && len(out) < spec.width {
+		out = prefix + strings.Repeat("0", spec.width-len(out)) + out[len(prefix):]
+	}
+	return out
+}
+
+// formatInteger formats v for the verb d, i, u, x, X or o. Only d and i are
+// signed; the others print the 64 bits as unsigned.
+func formatInteger(v int64, spec printfSpec) string {
+	var prefix string
+	var u uint64
+	if spec.verb == 'd' || spec.verb == 'i' {
+		switch {
+		case v < 0:
+			prefix, u = "-", uint64(-v)
+		case spec.plus:
+			prefix, u = "+", uint64(v)
+		case spec.space:
+			prefix, u = " ", uint64(v)
+		default:
+			u = uint64(v)
+		}
+	} else {
+		u = uint64(v)
+	}
+	var digits string
+	switch spec.verb {
+	case 'x':
+		digits = strconv.FormatUint(u, 16)
+	case 'X':
+		digits = strings.ToUpper(strconv.FormatUint(u, 16))
+	case 'o':
+		digits = strconv.FormatUint(u, 8)
+	default:
+		digits = strconv.FormatUint(u, 10)
+	}
+	precision := spec.precision
+	if spec.zeroPad && precision < spec.width-len(prefix) {
+		precision = spec.width - len(prefix)
+	}
+	if spec.thousands && spec.verb != 'x' && spec.verb != 'X' && spec.verb != 'o' {
+		var b strings.Builder
+		for i := range len(digits) {
+			if i > 0 && (len(digits)-i)%3 == 0 {
+				b.WriteByte(',')
+			}
+			b.WriteByte(digits[i])
+		}
+		digits = b.String()
+	}
+	if len(digits) < precision {
+		digits = strings.Repeat("0", precision-len(digits)) + digits
+	}
+	if spec.alternate && u != 0 {
+		switch spec.verb {
+		case 'x':
+			prefix += "0x"
+		case 'X':
+			prefix += "0X"
+		case 'o':
+			prefix += "0"
+		}
+	}
+	return prefix + digits
+}
+
+// sqlPrintf implements printf() and format(). Missing arguments count as NULL,
+// which prints as 0 or as an empty string.
+func sqlPrintf(format string, args []Value) string {
+	var out strings.Builder
+	next := func() Value {
+		if len(args) == 0 {
+			return NullValue()
+		}
+		v := args[0]
+		args = args[1:]
+		return v
+	}
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			out.WriteByte(c)
+			continue
+		}
+		spec := printfSpec{precision: -1}
+		i++
+		if i == len(format) {
+			out.WriteByte('%')
+			break
+		}
+	flags:
+		for ; i < len(format); i++ {
+			switch format[i] {
+			case '-':
+				spec.leftJustify = true
+			case '+':
+				spec.plus = true
+			case ' ':
+				spec.space = true
+			case '#':
+				spec.alternate = true
+			case '!':
+				spec.bang = true
+			case '0':
+				spec.zeroPad = true
+			case ',':
+				spec.thousands = true
+			default:
+				break flags
+			}
+		}
+		if i < len(format) && format[i] == '*' {
+			spec.width = int(intValue(next()))
+			if spec.width < 0 {
+				spec.leftJustify, spec.width = true, -spec.width
+			}
+			i++
+		}
+		for ; i < len(format) && isDigit(format[i]); i++ {
+			spec.width = spec.width*10 + int(format[i]-'0')
+		}
+		if i < len(format) && format[i] == '.' {
+			i++
+			spec.precision = 0
+			if i < len(format) && format[i] == '*' {
+				spec.precision = max(int(intValue(next())), -1)
+				i++
+			}
+			for ; i < len(format) && isDigit(format[i]); i++ {
+				spec.precision = spec.precision*10 + int(format[i]-'0')
+			}
+		}
+		// Length modifiers have no meaning for SQL values.
+		for i < len(format) && format[i] == 'l' {
+			i++
+		}
+		if i >= len(format) {
+			break
+		}
+		spec.verb = format[i]
+		var text string
+		switch spec.verb {
+		case '%':
+			text = "%"
+		case 'd', 'i', 'u', 'x', 'X', 'o':
+			text = formatInteger(intValue(next()), spec)
+		case 'f', 'e', 'E', 'g', 'G':
+			text = formatFloat(realValue(next()), spec)
+		case 's', 'z':
+			text = truncateBytes(next().String(), spec.precision)
+		case 'c':
+			r, _ := utf8.DecodeRuneInString(next().String())
+			text = ""
+			if r != utf8.RuneError {
+				text = strings.Repeat(string(r), max(spec.precision, 1))
+			}
+		case 'q', 'Q', 'w':
+			v := next()
+			if v.IsNull() {
+				text = "(NULL)"
+				if spec.verb == 'Q' {
+					text = "NULL"
+				}
+				break
+			}
+			quote := "'"
+			if spec.verb == 'w' {
+				quote = `"`
+			}
+			text = strings.ReplaceAll(truncateBytes(v.String(), spec.precision), quote, quote+quote)
+			if spec.verb == 'Q' {
+				text = "'" + text + "'"
+			}
+		case 'n':
+		default:
+			// SQLite stops at an unknown conversion.
+			return out.String()
+		}
+		if pad := spec.width - len(text); pad > 0 {
+			if spec.leftJustify {
+				text += strings.Repeat(" ", pad)
+			} else {
+				text = strings.Repeat(" ", pad) + text
+			}
+		}
+		out.WriteString(text)
+	}
+	return out.String()
+}
+
+// truncateBytes keeps the first n bytes of s, or all of it when n is negative.
+func truncateBytes(s string, n int) string {
+	if n >= 0 && n < len(s) {
+		return s[:n]
+	}
+	return s
+}
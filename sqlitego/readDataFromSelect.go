@@ -0,0 +1,566 @@
+package sqlitego
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// query is a planned SELECT: the columns of its result and the source of its
+// rows, which are read from the database as the caller asks for them.
+type query struct {
+	columns []outputColumn
+	rows    rowSource
+}
+
+// outputColumn describes one column of a query result.
+type outputColumn struct {
+	Name     string
+	DeclType string // declared type of the table column it reads; empty for expressions
+
+	// The expression, alias and collation of the column, which the ORDER BY of
+	// a compound SELECT matches its terms against.
+	expr      Expr
+	alias     string
+	collation Collation
+	explicit  bool // the collation was given by a COLLATE operator
+	// affinity is that of the column's expression, which a subquery used as a
+	// value or as a table of FROM keeps.
+	affinity Affinity
+}
+
+// readDataFromSelect plans a parsed SELECT.
+func readDataFromSelect(pager *Pager, catalog *Catalog, stmt *SelectStmt) (*query, error) {
+	return planSelect(&queryContext{pager: pager, catalog: catalog}, stmt)
+}
+
+// planSelect plans a SELECT, which is a subquery when ctx has an outer row.
+func planSelect(ctx *queryContext, stmt *SelectStmt) (*query, error) {
+	if stmt.With != nil {
+		var err error
+		if ctx, err = withContext(ctx, stmt.With); err != nil {
+			return nil, err
+		}
+	}
+	if len(stmt.Compound) > 0 {
+		return compoundSelect(ctx, stmt)
+	}
+	if len(stmt.From) == 0 {
+		sc := &scope{aliases: selectAliases(stmt), query: ctx}
+		src, err := whereFilter(&singleRow{row: Row{}}, stmt.Where, sc)
+		if err != nil {
+			return nil, err
+		}
+		return selectRows(stmt, src, sc, false)
+	}
+	tables, sc, err := resolveFrom(ctx, stmt.From)
+	if err != nil {
+		return nil, err
+	}
+	// The columns the query reads are recorded as it is compiled, so that tables
+	// are only decoded as far as needed.
+	sc.aliases, sc.query, sc.reads = selectAliases(stmt), ctx, map[int]bool{}
+	for _, t := range tables {
+		t.reads = &columnReads{reads: sc.reads, offset: t.offset}
+	}
+	if len(tables) > 1 {
+		src, err := planJoin(ctx.pager, ctx.catalog, tables, sc, stmt.Where)
+		if err != nil {
+			return nil, err
+		}
+		return selectRows(stmt, src, sc, false)
+	}
+	if tables[0].query != nil {
+		src, err := whereFilter(&derivedRows{src: tables[0].query.rows}, stmt.Where, sc)
+		if err != nil {
+			return nil, err
+		}
+		return selectRows(stmt, src, sc, false)
+	}
+	pager, catalog := ctx.pager, ctx.catalog
+	table, def := tables[0].entry, tables[0].def
+	tableName := table.Name
+	rootpage := table.RootPage
+
+	if isCountStar(stmt) && stmt.Where == nil && stmt.GroupBy == nil && stmt.Having == nil && stmt.OrderBy == nil && stmt.Limit == nil {
+		cnt, err := countRows(pager, catalog, tableName)
+		if err != nil {
+			return nil, err
+		}
+		return &query{columns: outputColumns(stmt.Columns, sc), rows: &singleRow{row: Row{IntegerValue(int64(cnt))}}}, nil
+	}
+
+	rowids, err := planRowidRange(def, sc, stmt.Where)
+	if err != nil {
+		return nil, err
+	}
+	isRowidLookup := rowids != nil && !rowids.in && rowids.lower == rowids.upper
+	plan, err := planIndexAccess(catalog, table, def, sc, stmt.Where)
+	if err != nil {
+		return nil, err
+	}
+	// A rowid range or list beats an index unless "=" terms fix some of the
+	// index's columns.
+	if rowids != nil && (isRowidLookup || rowids.in || plan == nil || plan.eq == 0) {
+		plan = nil
+	} else {
+		rowids = nil
+	}
+
+	// Prefer an access path that already delivers the rows grouped or sorted.
+	order := scanOrder(stmt, sc)
+	ordered := isRowidLookup
+	var reverse bool
+	switch {
+	case isRowidLookup:
+	case rowids != nil:
+		ordered, reverse = tableOrder(def, order)
+	case plan != nil:
+		ordered, reverse = plan.providesOrder(def, order)
+	default:
+		if ordered, reverse = tableOrder(def, order); !ordered {
+			if plan, reverse, err = planOrderedIndex(catalog, table, def, order); err != nil {
+				return nil, err
+			}
+			ordered = plan != nil
+		}
+	}
+
+	var src rowSource
+	switch {
+	case isRowidLookup:
+		src = &rowidLookup{def: def, cursor: NewCursor(pager, rootpage), reads: tables[0].reads, rowid: rowids.lower}
+	case rowids != nil:
+		scan := newRowidScan(pager, rootpage, def, rowids)
+		scan.reads, scan.reverse = tables[0].reads, reverse
+		src = scan
+	case plan != nil:
+		// Sử dụng index để lấy rowid
+		scan := newIndexScan(pager, rootpage, def, plan)
+		scan.reads, scan.ordered, scan.reverse = tables[0].reads, ordered, reverse
+		src = scan
+	default:
+		// Nếu không có index, fallback về quét bảng như cũ
+		scan := newTableScan(pager, rootpage, def)
+		scan.reads, scan.reverse = tables[0].reads, reverse
+		src = scan
+	}
+	if src, err = whereFilter(src, stmt.Where, sc); err != nil {
+		return nil, err
+	}
+	return selectRows(stmt, src, sc, ordered)
+}
+
+// whereFilter passes on the rows of src for which where, if any, is true.
+func whereFilter(src rowSource, where Expr, sc *scope) (rowSource, error) {
+	if where == nil {
+		return src, nil
+	}
+	pred, err := compileExpr(where, sc)
+	if err != nil {
+		return nil, err
+	}
+	return &filter{src: src, pred: pred}, nil
+}
+
+// selectRows applies the GROUP BY, HAVING, SELECT list, ORDER BY and LIMIT of
+// stmt to the rows of src, which have already passed the WHERE clause and whose
+// columns sc describes. ordered tells that src already delivers rows in the
+// order scanOrder asked for.
+func selectRows(stmt *SelectStmt, src rowSource, sc *scope, ordered bool) (*query, error) {
+	agg := &aggregateContext{input: &scope{columns: sc.columns, aliases: sc.aliases, query: sc.query, reads: sc.reads}}
+	win, err := newWindowContext(stmt, &scope{columns: sc.columns, aggregates: agg, query: sc.query, reads: sc.reads})
+	if err != nil {
+		return nil, err
+	}
+	out := &scope{columns: sc.columns, aggregates: agg, windows: win, query: sc.query, reads: sc.reads}
+	columns, err := compileResultColumns(stmt.Columns, out)
+	if err != nil {
+		return nil, err
+	}
+	var having *compiledExpr
+	if stmt.Having != nil {
+		if having, err = compileExpr(stmt.Having, &scope{columns: sc.columns, aliases: sc.aliases, aggregates: agg, query: sc.query, reads: sc.reads}); err != nil {
+			return nil, err
+		}
+	}
+	orderBy, err := compileOrderBy(stmt, &scope{columns: sc.columns, aliases: sc.aliases, aggregates: agg, windows: win, query: sc.query, reads: sc.reads})
+	if err != nil {
+		return nil, err
+	}
+	// The window results follow the aggregate results in the rows.
+	win.offset = len(sc.columns) + len(agg.calls)
+	// scanOrder asks for the order of a window only when nothing is aggregated.
+	windowOrdered := ordered && len(stmt.GroupBy) == 0
+
+	if len(stmt.GroupBy) > 0 || len(agg.calls) > 0 {
+		groupBy, err := compileGroupBy(stmt, sc)
+		if err != nil {
+			return nil, err
+		}
+		if len(groupBy) > 0 && !ordered {
+			keys := make([]sortKey, len(groupBy))
+			for i, key := range groupBy {
+				keys[i] = sortKey{expr: key, nullsFirst: true}
+			}
+			src = newSorter(src, keys)
+		}
+		src = newAggregate(src, groupBy, agg)
+		if having != nil {
+			src = &filter{src: src, pred: having}
+		}
+		// Groups come out in ascending order of their keys.
+		ordered = len(groupBy) == 0 || orderFollowsGroups(stmt, sc)
+	} else if having != nil {
+		return nil, fmt.Errorf("HAVING clause on a non-aggregate query")
+	}
+	if len(win.windows) > 0 {
+		src = win.rows(src, windowOrdered && len(agg.calls) == 0)
+		ordered = false
+	}
+	if stmt.Distinct {
+		src = newDistinct(src, columns)
+	}
+	if len(orderBy) > 0 && !ordered {
+		src = newSorter(src, orderBy)
+	}
+	src = &projection{src: src, columns: columns}
+	if stmt.Limit != nil {
+		if src, err = applyLimit(stmt, src, sc.query); err != nil {
+			return nil, err
+		}
+	}
+	result := outputColumns(stmt.Columns, sc)
+	for i := range result {
+		result[i].affinity, result[i].collation, result[i].explicit = columns[i].affinity, columns[i].collation, columns[i].explicit
+	}
+	return &query{columns: result, rows: src}, nil
+}
+
+// compileOrderBy compiles the ORDER BY terms into sort keys. A term may number
+// a column of the SELECT list or name one of its aliases.
+func compileOrderBy(stmt *SelectStmt, sc *scope) ([]sortKey, error) {
+	var keys []sortKey
+	for i, term := range stmt.OrderBy {
+		expr, err := orderTermExpr(stmt, i, sc)
+		if err != nil {
+			return nil, err
+		}
+		key, err := compileExpr(expr, sc)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, sortKey{expr: key, desc: term.Desc, nullsFirst: nullsFirst(term)})
+	}
+	return keys, nil
+}
+
+// orderTermExpr resolves the i-th ORDER BY term: an integer constant stands for
+// a column of the SELECT list, and a bare name matching an alias of the SELECT
+// list takes that column's expression before any table column. Either may carry
+// a COLLATE, which then applies to the column.
+func orderTermExpr(stmt *SelectStmt, i int, sc *scope) (Expr, error) {
+	return orderTerm(stmt, stmt.OrderBy[i].Expr, i, sc)
+}
+
+func orderTerm(stmt *SelectStmt, expr Expr, i int, sc *scope) (Expr, error) {
+	if c, ok := expr.(*CollateExpr); ok {
+		inner, err := orderTerm(stmt, c.Expr, i, sc)
+		if err != nil || inner == c.Expr {
+			return expr, err
+		}
+		return &CollateExpr{Expr: inner, Collation: c.Collation}, nil
+	}
+	if ref, ok := expr.(*ColumnRef); ok && ref.Table == "" {
+		for _, col := range stmt.Columns {
+			if col.Alias != "" && strings.EqualFold(col.Alias, ref.Column) {
+				return col.Expr, nil
+			}
+		}
+	}
+	return resultColumnTerm(expr, stmt.Columns, sc, i, "ORDER BY")
+}
+
+func nullsFirst(term OrderingTerm) bool {
+	return term.Nulls == "FIRST" || term.Nulls == "" && !term.Desc
+}
+
+// scanOrder returns the order in which the access path should deliver rows: the
+// GROUP BY terms, or else the partition and order of the window computed first,
+// or else the ORDER BY terms. It returns nil when some term is not a plain
+// column of the table, as no index can deliver that order.
+func scanOrder(stmt *SelectStmt, sc *scope) []orderColumn {
+	var order []orderColumn
+	if len(stmt.GroupBy) == 0 {
+		if spec, ok := lastWindow(stmt); ok {
+			if spec == nil {
+				return nil
+			}
+			for _, expr := range spec.PartitionBy {
+				col, ok := columnIndex(expr, sc)
+				if !ok {
+					return nil
+				}
+				order = append(order, orderColumn{col: col, nullsFirst: true})
+			}
+			for _, term := range spec.OrderBy {
+				col, ok := columnIndex(term.Expr, sc)
+				if !ok {
+					return nil
+				}
+				order = append(order, orderColumn{col: col, desc: term.Desc, nullsFirst: nullsFirst(term)})
+			}
+			return order
+		}
+	}
+	if len(stmt.GroupBy) > 0 {
+		for i := range stmt.GroupBy {
+			expr, err := resultColumnTerm(stmt.GroupBy[i], stmt.Columns, sc, i, "GROUP BY")
+			col, ok := columnIndex(expr, sc)
+			if err != nil || !ok {
+				return nil
+			}
+			order = append(order, orderColumn{col: col, nullsFirst: true})
+		}
+		return order
+	}
+	for i, term := range stmt.OrderBy {
+		expr, err := orderTermExpr(stmt, i, sc)
+		col, ok := columnIndex(expr, sc)
+		if err != nil || !ok {
+			return nil
+		}
+		order = append(order, orderColumn{col: col, desc: term.Desc, nullsFirst: nullsFirst(term)})
+	}
+	return order
+}
+
+// orderFollowsGroups reports whether the ORDER BY terms are a prefix of the
+// GROUP BY terms in ascending order, which the groups already come out in.
+func orderFollowsGroups(stmt *SelectStmt, sc *scope) bool {
+	if len(stmt.OrderBy) > len(stmt.GroupBy) {
+		return false
+	}
+	for i, term := range stmt.OrderBy {
+		if term.Desc || !nullsFirst(term) {
+			return false
+		}
+		orderExpr, err := orderTermExpr(stmt, i, sc)
+		if err != nil {
+			return false
+		}
+		groupExpr, err := resultColumnTerm(stmt.GroupBy[i], stmt.Columns, sc, i, "GROUP BY")
+		if err != nil {
+			return false
+		}
+		a, okA := columnIndex(orderExpr, sc)
+		b, okB := columnIndex(groupExpr, sc)
+		if !okA || !okB || a != b {
+			return false
+		}
+	}
+	return true
+}
+
+// columnIndex returns the scope position of expr when it is a plain column.
+func columnIndex(expr Expr, sc *scope) (int, bool) {
+	ref, ok := expr.(*ColumnRef)
+	if !ok {
+		return 0, false
+	}
+	idx, err := sc.resolve(ref)
+	return idx, err == nil && idx >= 0
+}
+
+// applyLimit evaluates LIMIT and OFFSET, which must be integers. They cannot
+// refer to the queries around a subquery.
+func applyLimit(stmt *SelectStmt, src rowSource, ctx *queryContext) (rowSource, error) {
+	sc := &scope{query: &queryContext{pager: ctx.pager, catalog: ctx.catalog, with: ctx.with}}
+	count, err := limitValue(stmt.Limit, sc)
+	if err != nil {
+		return nil, err
+	}
+	var offset int64
+	if stmt.Offset != nil {
+		if offset, err = limitValue(stmt.Offset, sc); err != nil {
+			return nil, err
+		}
+	}
+	return &limit{src: src, count: count, offset: max(offset, 0)}, nil
+}
+
+func limitValue(expr Expr, sc *scope) (int64, error) {
+	compiled, err := compileExpr(expr, sc)
+	if err != nil {
+		return 0, err
+	}
+	v, err := compiled.eval(nil)
+	if err != nil {
+		return 0, err
+	}
+	v = v.applyAffinity(AffinityNumeric)
+	if v.Type != TypeInteger {
+		return 0, fmt.Errorf("datatype mismatch")
+	}
+	return v.Int, nil
+}
+
+// compileGroupBy compiles the GROUP BY terms. An integer constant N stands for
+// the N-th column of the SELECT list.
+func compileGroupBy(stmt *SelectStmt, sc *scope) ([]*compiledExpr, error) {
+	var keys []*compiledExpr
+	for i, term := range stmt.GroupBy {
+		term, err := resultColumnTerm(term, stmt.Columns, sc, i, "GROUP BY")
+		if err != nil {
+			return nil, err
+		}
+		key, err := compileExpr(term, sc)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// resultColumnTerm replaces an integer constant term of clause by the
+// expression of the SELECT list column it numbers, keeping a COLLATE around it.
+func resultColumnTerm(term Expr, cols []ResultColumn, sc *scope, i int, clause string) (Expr, error) {
+	if c, ok := term.(*CollateExpr); ok {
+		inner, err := resultColumnTerm(c.Expr, cols, sc, i, clause)
+		if err != nil || inner == c.Expr {
+			return term, err
+		}
+		return &CollateExpr{Expr: inner, Collation: c.Collation}, nil
+	}
+	lit, ok := term.(*Literal)
+	if !ok || lit.Value.Type != TypeInteger {
+		return term, nil
+	}
+	var exprs []Expr
+	for _, col := range outputColumns(cols, sc) {
+		exprs = append(exprs, col.expr)
+	}
+	n := lit.Value.Int
+	if n < 1 || n > int64(len(exprs)) {
+		return nil, fmt.Errorf("%s %s term out of range - should be between 1 and %d", ordinal(i+1), clause, len(exprs))
+	}
+	return exprs[n-1], nil
+}
+
+// ordinal spells n as "1st", "2nd", "3rd", "4th" and so on.
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// selectAliases maps the lower-cased aliases of the SELECT list to their
+// expressions.
+func selectAliases(stmt *SelectStmt) map[string]Expr {
+	aliases := map[string]Expr{}
+	for _, col := range stmt.Columns {
+		if _, dup := aliases[strings.ToLower(col.Alias)]; col.Alias != "" && !dup {
+			aliases[strings.ToLower(col.Alias)] = col.Expr
+		}
+	}
+	return aliases
+}
+
+// starColumns returns the scope positions "*" or "table.*" expands to, in
+// schema order.
+func starColumns(col ResultColumn, sc *scope) ([]int, error) {
+	if len(sc.columns) == 0 {
+		return nil, fmt.Errorf("no tables specified")
+	}
+	var positions []int
+	found := false
+	for i, c := range sc.columns {
+		if col.Table == "" && !c.Using && !c.Hidden {
+			positions = append(positions, i)
+		}
+		if col.Table != "" && strings.EqualFold(c.Table, col.Table) {
+			// A USING column belongs to its own table when the table is named.
+			if found = true; !c.Hidden {
+				positions = append(positions, i)
+			}
+		}
+	}
+	if col.Table != "" && !found {
+		return nil, fmt.Errorf("no such table: %s", col.Table)
+	}
+	return positions, nil
+}
+
+// compileResultColumns compiles the SELECT list, expanding "*" and "table.*"
+// to the columns they stand for.
+func compileResultColumns(cols []ResultColumn, sc *scope) ([]*compiledExpr, error) {
+	var compiled []*compiledExpr
+	for _, col := range cols {
+		if col.Star {
+			positions, err := starColumns(col, sc)
+			if err != nil {
+				return nil, err
+			}
+			for _, i := range positions {
+				c := sc.columns[i]
+				if sc.reads != nil {
+					sc.reads[i] = true
+				}
+				compiled = append(compiled, &compiledExpr{eval: func(row Row) (Value, error) { return row[i], nil }, affinity: c.Affinity, collation: c.Collation})
+			}
+			continue
+		}
+		expr, err := compileExpr(col.Expr, sc)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, expr)
+	}
+	return compiled, nil
+}
+
+// outputColumns names the result columns the way sqlite3 does: by alias, then
+// by the declared name of a plain column, then by the source text.
+func outputColumns(cols []ResultColumn, sc *scope) []outputColumn {
+	var out []outputColumn
+	for _, col := range cols {
+		if col.Star {
+			positions, _ := starColumns(col, sc)
+			for _, i := range positions {
+				c := sc.columns[i]
+				out = append(out, outputColumn{Name: c.Name, DeclType: c.DeclType, expr: &ColumnRef{Table: c.Table, Column: c.Name}})
+			}
+			continue
+		}
+		oc := outputColumn{Name: col.Text}
+		if ref, ok := col.Expr.(*ColumnRef); ok {
+			if idx, err := sc.resolve(ref); err == nil && idx >= 0 {
+				oc = outputColumn{Name: sc.columns[idx].Name, DeclType: sc.columns[idx].DeclType}
+			}
+		}
+		oc.expr = col.Expr
+		if col.Alias != "" {
+			oc.Name, oc.alias = col.Alias, col.Alias
+		}
+		out = append(out, oc)
+	}
+	return out
+}
+
+// isCountStar reports whether the SELECT list is exactly COUNT(*).
+func isCountStar(stmt *SelectStmt) bool {
+	if len(stmt.Columns) != 1 {
+		return false
+	}
+	call, ok := stmt.Columns[0].Expr.(*FuncCall)
+	return ok && call.Star && strings.EqualFold(call.Name, "count") && call.Over == nil && call.Window == ""
+}
@@ -0,0 +1,81 @@
+package sqlitego
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// rowSet remembers rows in order to report duplicates. Rows are equal when every
+// column compares equal under its collation, so 1 and 1.0 are the same and, under
+// NOCASE, so are 'a' and 'A'.
+type rowSet struct {
+	collations []Collation
+	buckets    map[string][]Row
+}
+
+func newRowSet(collations []Collation) *rowSet {
+	return &rowSet{collations: collations, buckets: map[string][]Row{}}
+}
+
+// add inserts row and reports whether it was not in the set yet.
+func (s *rowSet) add(row Row) bool {
+	key := s.hashKey(row)
+	for _, other := range s.buckets[key] {
+		if compareRows(row, other, s.collations) == 0 {
+			return false
+		}
+	}
+	s.buckets[key] = append(s.buckets[key], row)
+	return true
+}
+
+// has reports whether row is in the set.
+func (s *rowSet) has(row Row) bool {
+	for _, other := range s.buckets[s.hashKey(row)] {
+		if compareRows(row, other, s.collations) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compareRows compares two rows column by column, each under its collation.
+func compareRows(a, b Row, collations []Collation) int {
+	for i := range a {
+		if c := CompareValues(a[i], b[i], collations[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// hashKey encodes row so that rows equal under any built-in collation share a
+// key: numbers are reduced to one form and TEXT is lower-cased and right-trimmed.
+// Rows with the same key are told apart by compareRows.
+func (s *rowSet) hashKey(row Row) string {
+	var buf []byte
+	for _, v := range row {
+		buf = append(buf, byte(v.typeClass()))
+		switch v.Type {
+		case TypeInteger:
+			buf = binary.BigEndian.AppendUint64(buf, uint64(v.Int))
+		case TypeReal:
+			if i, ok := realAsInteger(v.Real); ok {
+				buf = binary.BigEndian.AppendUint64(buf, uint64(i))
+			} else {
+				buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(v.Real))
+			}
+		case TypeText:
+			text := bytes.TrimRight(v.Bytes, " ")
+			buf = binary.AppendUvarint(buf, uint64(len(text)))
+			for _, c := range text {
+				buf = append(buf, asciiLower(c))
+			}
+		case TypeBlob:
+			buf = binary.AppendUvarint(buf, uint64(len(v.Bytes)))
+			buf = append(buf, v.Bytes...)
+		}
+	}
+	return string(buf)
+}
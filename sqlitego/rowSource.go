@@ -0,0 +1,505 @@
+package sqlitego
+
+import (
+	"errors"
+	"slices"
+)
+
+// rowSource produces the rows of a query one at a time, so a query holds only
+// the rows it is working on rather than its whole result.
+type rowSource interface {
+	// Next advances to the next row and reports false when there are no more.
+	Next() (bool, error)
+	// Row returns the current row. Sources return a fresh Row from every call to
+	// Next, so callers may keep it.
+	Row() Row
+	// Close releases what the source holds, such as temporary files. It may be
+	// called before the rows run out, and more than once.
+	Close() error
+}
+
+// rewinder is a source that can start over from its first row, so that a plan
+// is run again without being planned again, as the recursive SELECT of a common
+// table is for every row of the table.
+type rewinder interface {
+	// rewind reports false when the source cannot start over.
+	rewind() bool
+}
+
+// rewind starts src over, reporting false when it cannot.
+func rewind(src rowSource) bool {
+	r, ok := src.(rewinder)
+	return ok && r.rewind()
+}
+
+// tableRow expands a stored record into one value per column of the table,
+// followed by the rowid.
+func tableRow(def *TableDef, rec Record, rowid int64) Row {
+	row := make(Row, len(def.Columns)+1)
+	for i := range def.Columns {
+		row[i] = def.columnValue(rec, rowid, i)
+	}
+	row[len(def.Columns)] = IntegerValue(rowid)
+	return row
+}
+
+// columnReads tells the sources reading a table which of its columns a query
+// reads, so that each row is decoded only up to the last of them and overflow
+// pages holding only later columns are skipped. reads holds the scope positions
+// that the query's expressions read, with the table's first column at offset.
+// It is complete once the query is compiled, before the first row is read. A
+// nil *columnReads reads every column.
+type columnReads struct {
+	reads   map[int]bool
+	offset  int
+	columns int // number of leading stored columns to decode, once counted
+	counted bool
+}
+
+func (c *columnReads) count(def *TableDef) int {
+	if c == nil {
+		return -1
+	}
+	if !c.counted {
+		c.columns, c.counted = 0, true
+		for i := range def.Columns {
+			// The rowid alias is read from the cell's rowid, not the record.
+			if c.reads[c.offset+i] && i != def.RowidAlias {
+				c.columns = i + 1
+			}
+		}
+	}
+	return c.columns
+}
+
+// tableScan reads every row of a rowid table in rowid order, or in reverse
+// rowid order when reverse is set.
+type tableScan struct {
+	def     *TableDef
+	cursor  *Cursor
+	reads   *columnReads
+	reverse bool
+	started bool
+	row     Row
+}
+
+func newTableScan(pager *Pager, root int, def *TableDef) *tableScan {
+	return &tableScan{def: def, cursor: NewCursor(pager, root)}
+}
+
+func (s *tableScan) Next() (bool, error) {
+	var ok bool
+	var err error
+	switch {
+	case s.started && s.reverse:
+		ok, err = s.cursor.Prev()
+	case s.started:
+		ok, err = s.cursor.Next()
+	case s.reverse:
+		ok, err = s.cursor.Last()
+	default:
+		ok, err = s.cursor.First()
+	}
+	s.started = true
+	if !ok || err != nil {
+		return false, err
+	}
+	rowid, err := s.cursor.Rowid()
+	if err != nil {
+		return false, err
+	}
+	rec, err := s.cursor.RecordColumns(s.reads.count(s.def))
+	if err != nil {
+		return false, err
+	}
+	s.row = tableRow(s.def, rec, rowid)
+	return true, nil
+}
+
+func (s *tableScan) Row() Row {
+	return s.row
+}
+
+func (s *tableScan) Close() error {
+	return nil
+}
+
+// rowidLookup returns the row with the given rowid, if there is one.
+type rowidLookup struct {
+	def    *TableDef
+	cursor *Cursor
+	reads  *columnReads
+	rowid  int64
+	done   bool
+	row    Row
+}
+
+func (s *rowidLookup) Next() (bool, error) {
+	if s.done {
+		return false, nil
+	}
+	s.done = true
+	rec, err := lookupRowid(s.cursor, s.rowid, s.reads.count(s.def))
+	if errors.Is(err, ErrRowidNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	s.row = tableRow(s.def, rec, s.rowid)
+	return true, nil
+}
+
+func (s *rowidLookup) Row() Row {
+	return s.row
+}
+
+func (s *rowidLookup) Close() error {
+	return nil
+}
+
+// rowidScan reads the rows whose rowids a rowidRange allows, in rowid order or
+// in reverse when reverse is set. A list is read by seeking each rowid in turn,
+// which costs little more than a scan as the seeks move along the leaf pages; a
+// range is read by seeking its first rowid and stepping until past its last.
+type rowidScan struct {
+	def     *TableDef
+	cursor  *Cursor
+	reads   *columnReads
+	rowids  *rowidRange
+	reverse bool
+	started bool
+	pos     int
+	row     Row
+}
+
+func newRowidScan(pager *Pager, root int, def *TableDef, rowids *rowidRange) *rowidScan {
+	return &rowidScan{def: def, cursor: NewCursor(pager, root), rowids: rowids}
+}
+
+func (s *rowidScan) Next() (bool, error) {
+	if s.rowids.in {
+		return s.nextListed()
+	}
+	var ok bool
+	var err error
+	switch {
+	case s.started && s.reverse:
+		ok, err = s.cursor.Prev()
+	case s.started:
+		ok, err = s.cursor.Next()
+	case s.reverse:
+		ok, err = s.seekUpper()
+	default:
+		ok, err = s.cursor.SeekRowid(s.rowids.lower)
+	}
+	s.started = true
+	if !ok || err != nil {
+		return false, err
+	}
+	rowid, err := s.cursor.Rowid()
+	if err != nil {
+		return false, err
+	}
+	if rowid < s.rowids.lower || rowid > s.rowids.upper {
+		return false, nil
+	}
+	rec, err := s.cursor.RecordColumns(s.reads.count(s.def))
+	if err != nil {
+		return false, err
+	}
+	s.row = tableRow(s.def, rec, rowid)
+	return true, nil
+}
+
+// nextListed moves to the next rowid of the list that the table holds.
+func (s *rowidScan) nextListed() (bool, error) {
+	list := s.rowids.list
+	for s.pos < len(list) {
+		rowid := list[s.pos]
+		if s.reverse {
+			rowid = list[len(list)-1-s.pos]
+		}
+		s.pos++
+		rec, err := lookupRowid(s.cursor, rowid, s.reads.count(s.def))
+		if errors.Is(err, ErrRowidNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		s.row = tableRow(s.def, rec, rowid)
+		return true, nil
+	}
+	return false, nil
+}
+
+// seekUpper positions the cursor on the last row within the upper bound.
+func (s *rowidScan) seekUpper() (bool, error) {
+	ok, err := s.cursor.SeekRowid(s.rowids.upper)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return s.cursor.Last()
+	}
+	rowid, err := s.cursor.Rowid()
+	if err != nil || rowid <= s.rowids.upper {
+		return err == nil, err
+	}
+	return s.cursor.Prev()
+}
+
+func (s *rowidScan) Row() Row {
+	return s.row
+}
+
+func (s *rowidScan) Close() error {
+	return nil
+}
+
+// rowidBatchSize is how many rowids an index scan collects before the table rows
+// are fetched in rowid order.
+const rowidBatchSize = 1024
+
+// indexScan reads the rows whose index entries lie between the bounds of a plan.
+// Rowids are taken from the index in batches, sorted, and looked up with a single
+// table cursor, so rows sharing a leaf page are found without going back to the
+// root. An ordered scan skips the sorting to deliver rows in index order, or in
+// reverse index order when reverse is set.
+type indexScan struct {
+	def       *TableDef
+	reads     *columnReads
+	plan      *indexPlan
+	index     *Cursor
+	table     *Cursor
+	ordered   bool
+	reverse   bool
+	started   bool
+	exhausted bool
+	batch     []int64
+	pos       int
+	row       Row
+}
+
+func newIndexScan(pager *Pager, root int, def *TableDef, plan *indexPlan) *indexScan {
+	return &indexScan{
+		def:   def,
+		plan:  plan,
+		index: NewCursor(pager, plan.root),
+		table: NewCursor(pager, root),
+		batch: make([]int64, 0, rowidBatchSize),
+	}
+}
+
+func (s *indexScan) Next() (bool, error) {
+	for s.pos == len(s.batch) {
+		if s.exhausted {
+			return false, nil
+		}
+		if err := s.fill(); err != nil {
+			return false, err
+		}
+	}
+	rowid := s.batch[s.pos]
+	s.pos++
+	rec, err := lookupRowid(s.table, rowid, s.reads.count(s.def))
+	if err != nil {
+		return false, err
+	}
+	s.row = tableRow(s.def, rec, rowid)
+	return true, nil
+}
+
+// fill collects the next batch of rowids from the index.
+func (s *indexScan) fill() error {
+	s.batch, s.pos = s.batch[:0], 0
+	for len(s.batch) < rowidBatchSize {
+		var ok bool
+		var err error
+		switch {
+		case s.started && s.reverse:
+			ok, err = s.index.Prev()
+		case s.started:
+			ok, err = s.index.Next()
+		case s.reverse:
+			ok, err = s.seekUpper()
+		case s.plan.lower != nil:
+			ok, err = s.index.SeekIndex(s.plan.afterLower)
+		default:
+			ok, err = s.index.First()
+		}
+		s.started = true
+		if err != nil {
+			return err
+		}
+		if ok {
+			rec, err := s.index.Record()
+			if err != nil {
+				return err
+			}
+			if s.reverse {
+				ok = s.plan.afterLower(rec.Values)
+			} else {
+				ok = s.plan.beforeUpper(rec.Values)
+			}
+		}
+		if !ok {
+			s.exhausted = true
+			break
+		}
+		rowid, err := s.index.Rowid()
+		if err != nil {
+			return err
+		}
+		s.batch = append(s.batch, rowid)
+	}
+	if !s.ordered {
+		slices.Sort(s.batch)
+	}
+	return nil
+}
+
+// seekUpper positions the index cursor on the last entry within the upper bound.
+func (s *indexScan) seekUpper() (bool, error) {
+	if s.plan.upper == nil {
+		return s.index.Last()
+	}
+	ok, err := s.index.SeekIndex(func(values []Value) bool { return !s.plan.beforeUpper(values) })
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return s.index.Prev()
+	}
+	return s.index.Last()
+}
+
+func (s *indexScan) Row() Row {
+	return s.row
+}
+
+func (s *indexScan) Close() error {
+	return nil
+}
+
+// filter passes on the rows for which pred is true.
+type filter struct {
+	src  rowSource
+	pred *compiledExpr
+}
+
+func (f *filter) Next() (bool, error) {
+	for {
+		ok, err := f.src.Next()
+		if !ok || err != nil {
+			return false, err
+		}
+		v, err := f.pred.eval(f.src.Row())
+		if err != nil {
+			return false, err
+		}
+		if truth, _ := truthValue(v); truth {
+			return true, nil
+		}
+	}
+}
+
+func (f *filter) Row() Row {
+	return f.src.Row()
+}
+
+func (f *filter) Close() error {
+	return f.src.Close()
+}
+
+func (f *filter) rewind() bool {
+	return rewind(f.src)
+}
+
+// projection evaluates the SELECT list against each row of its source.
+type projection struct {
+	src     rowSource
+	columns []*compiledExpr
+	row     Row
+}
+
+func (p *projection) Next() (bool, error) {
+	ok, err := p.src.Next()
+	if !ok || err != nil {
+		return false, err
+	}
+	in := p.src.Row()
+	p.row = make(Row, len(p.columns))
+	for i, col := range p.columns {
+		if p.row[i], err = col.eval(in); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (p *projection) Row() Row {
+	return p.row
+}
+
+func (p *projection) Close() error {
+	return p.src.Close()
+}
+
+func (p *projection) rewind() bool {
+	return rewind(p.src)
+}
+
+// limit skips the first offset rows of its source and then passes on at most
+// count rows. A negative count means no limit.
+type limit struct {
+	src    rowSource
+	count  int64
+	offset int64
+}
+
+func (l *limit) Next() (bool, error) {
+	for ; l.offset > 0; l.offset-- {
+		if ok, err := l.src.Next(); !ok || err != nil {
+			return false, err
+		}
+	}
+	if l.count == 0 {
+		return false, nil
+	}
+	if l.count > 0 {
+		l.count--
+	}
+	return l.src.Next()
+}
+
+func (l *limit) Row() Row {
+	return l.src.Row()
+}
+
+func (l *limit) Close() error {
+	return l.src.Close()
+}
+
+// singleRow yields one precomputed row.
+type singleRow struct {
+	row  Row
+	done bool
+}
+
+func (s *singleRow) Next() (bool, error) {
+	if s.done {
+		return false, nil
+	}
+	s.done = true
+	return true, nil
+}
+
+func (s *singleRow) Row() Row {
+	return s.row
+}
+
+func (s *singleRow) Close() error {
+	return nil
+}
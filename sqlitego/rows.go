@@ -0,0 +1,201 @@
+package sqlitego
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Rows is the result of a query. Rows are read from the database one at a time
+// as Next is called.
+type Rows struct {
+	columns []outputColumn
+	src     rowSource
+	row     Row
+	err     error
+	closed  bool
+}
+
+// Columns returns the names of the result columns.
+func (r *Rows) Columns() []string {
+	names := make([]string, len(r.columns))
+	for i, col := range r.columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// DeclTypes returns the declared type of each result column that reads a table
+// column, and "" for the others.
+func (r *Rows) DeclTypes() []string {
+	types := make([]string, len(r.columns))
+	for i, col := range r.columns {
+		types[i] = col.DeclType
+	}
+	return types
+}
+
+// Next advances to the next row. It returns false when there are no more rows
+// or an error occurred; Err tells the two apart.
+func (r *Rows) Next() bool {
+	if r.closed || r.err != nil {
+		return false
+	}
+	ok, err := r.src.Next()
+	if err != nil {
+		r.err = err
+		return false
+	}
+	if !ok {
+		r.row = nil
+		if err := r.Close(); err != nil {
+			r.err = err
+		}
+		return false
+	}
+	r.row = r.src.Row()
+	return true
+}
+
+// Values returns the current row. The slice is only valid until the next call
+// to Next.
+func (r *Rows) Values() []Value {
+	return r.row
+}
+
+func (r *Rows) Err() error {
+	return r.err
+}
+
+func (r *Rows) Close() error {
+	r.closed = true
+	r.row = nil
+	return r.src.Close()
+}
+
+// Scan copies the columns of the current row into dest, which must hold one
+// pointer per column: *any, *Value, *string, *[]byte, *int, *int64, *float64
+// or *bool.
+func (r *Rows) Scan(dest ...any) error {
+	if r.row == nil {
+		return errors.New("Scan called without a current row")
+	}
+	if len(dest) != len(r.row) {
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(r.row), len(dest))
+	}
+	for i, d := range dest {
+		if err := scanValue(r.row[i], d); err != nil {
+			return fmt.Errorf("failed to scan column %d (%s): %w", i, r.columns[i].Name, err)
+		}
+	}
+	return nil
+}
+
+func scanValue(v Value, dest any) error {
+	switch d := dest.(type) {
+	case *Value:
+		v.Bytes = cloneBytes(v.Bytes)
+		*d = v
+		return nil
+	case *any:
+		*d = goValue(v)
+		return nil
+	case *[]byte:
+		switch v.Type {
+		case TypeNull:
+			*d = nil
+		case TypeText, TypeBlob:
+			*d = cloneBytes(v.Bytes)
+		default:
+			*d = []byte(v.String())
+		}
+		return nil
+	}
+	if v.IsNull() {
+		return fmt.Errorf("cannot convert NULL to %T", dest)
+	}
+	switch d := dest.(type) {
+	case *string:
+		*d = v.String()
+	case *int64:
+		i, err := integerOf(v)
+		if err != nil {
+			return err
+		}
+		*d = i
+	case *int:
+		i, err := integerOf(v)
+		if err != nil {
+			return err
+		}
+		*d = int(i)
+	case *float64:
+		f, err := floatOf(v)
+		if err != nil {
+			return err
+		}
+		*d = f
+	case *bool:
+		f, err := floatOf(v)
+		if err != nil {
+			return err
+		}
+		*d = f != 0
+	default:
+		return fmt.Errorf("unsupported destination type %T", dest)
+	}
+	return nil
+}
+
+// goValue converts a value to the Go type database/sql uses for it: nil, int64,
+// float64, string or []byte.
+func goValue(v Value) any {
+	switch v.Type {
+	case TypeInteger:
+		return v.Int
+	case TypeReal:
+		return v.Real
+	case TypeText:
+		return string(v.Bytes)
+	case TypeBlob:
+		return cloneBytes(v.Bytes)
+	}
+	return nil
+}
+
+func integerOf(v Value) (int64, error) {
+	switch v.Type {
+	case TypeInteger:
+		return v.Int, nil
+	case TypeReal:
+		if v.Real == math.Trunc(v.Real) && v.Real >= math.MinInt64 && v.Real < math.MaxInt64 {
+			return int64(v.Real), nil
+		}
+	case TypeText:
+		if i, err := strconv.ParseInt(strings.TrimSpace(string(v.Bytes)), 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("cannot convert %s %q to an integer", v.Type, v.String())
+}
+
+func floatOf(v Value) (float64, error) {
+	switch v.Type {
+	case TypeInteger, TypeReal:
+		return v.float(), nil
+	case TypeText:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(string(v.Bytes)), 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("cannot convert %s %q to a float", v.Type, v.String())
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,319 @@
+package sqlitego
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+)
+
+// sortMemoryBudget is roughly how many bytes of rows a sorter keeps in memory.
+// Larger inputs are sorted in runs that are written to temporary files and
+// merged.
+var sortMemoryBudget = 64 << 20
+
+// sortKey is one term of the order a sorter produces.
+type sortKey struct {
+	expr       *compiledExpr
+	desc       bool
+	nullsFirst bool
+}
+
+// sorter reads its whole source and returns the rows ordered by keys. Rows with
+// equal keys keep the order they arrived in.
+type sorter struct {
+	src    rowSource
+	keys   []sortKey
+	budget int
+
+	loaded bool
+	rows   []sortedRow // the rows in memory, or the rows of the current run
+	size   int         // estimated bytes held by rows
+	pos    int
+	runs   []*sortRun
+	merge  runHeap
+	row    Row
+}
+
+type sortedRow struct {
+	keys []Value
+	row  Row
+}
+
+// sortRun is a sorted run spilled to a temporary file.
+type sortRun struct {
+	file   *os.File
+	reader *bufio.Reader
+	seq    int // position of the run, which breaks ties so the merge is stable
+	head   sortedRow
+}
+
+func newSorter(src rowSource, keys []sortKey) *sorter {
+	return &sorter{src: src, keys: keys, budget: sortMemoryBudget, pos: -1}
+}
+
+func (s *sorter) Next() (bool, error) {
+	if !s.loaded {
+		s.loaded = true
+		if err := s.load(); err != nil {
+			return false, err
+		}
+	}
+	if s.runs == nil {
+		s.pos++
+		if s.pos >= len(s.rows) {
+			return false, nil
+		}
+		s.row = s.rows[s.pos].row
+		return true, nil
+	}
+	if s.merge.Len() == 0 {
+		return false, s.Close()
+	}
+	run := s.merge.runs[0]
+	s.row = run.head.row
+	ok, err := run.read(len(s.keys))
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		heap.Fix(&s.merge, 0)
+	} else {
+		heap.Pop(&s.merge)
+	}
+	return true, nil
+}
+
+// load reads the source. Whenever the rows held exceed the budget they are
+// sorted and spilled as a run; if any run was spilled, the rest follows as a
+// last run and the runs are merged.
+func (s *sorter) load() error {
+	for {
+		ok, err := s.src.Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		row := s.src.Row()
+		keys := make([]Value, len(s.keys))
+		for i, key := range s.keys {
+			if keys[i], err = key.expr.eval(row); err != nil {
+				return err
+			}
+		}
+		s.rows = append(s.rows, sortedRow{keys: keys, row: row})
+		s.size += valuesSize(keys) + valuesSize(row)
+		if s.size > s.budget {
+			if err := s.spill(); err != nil {
+				return err
+			}
+		}
+	}
+	s.sortRows()
+	if s.runs == nil {
+		return nil
+	}
+	if err := s.spill(); err != nil {
+		return err
+	}
+	s.merge = runHeap{sorter: s}
+	for _, run := range s.runs {
+		if _, err := run.file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind sort run: %w", err)
+		}
+		run.reader = bufio.NewReader(run.file)
+		ok, err := run.read(len(s.keys))
+		if err != nil {
+			return err
+		}
+		if ok {
+			s.merge.runs = append(s.merge.runs, run)
+		}
+	}
+	heap.Init(&s.merge)
+	return nil
+}
+
+func (s *sorter) sortRows() {
+	slices.SortStableFunc(s.rows, func(a, b sortedRow) int {
+		return s.compare(a.keys, b.keys)
+	})
+}
+
+// spill sorts the rows held in memory and writes them to a new run file.
+func (s *sorter) spill() error {
+	s.sortRows()
+	file, err := os.CreateTemp("", "sqlitego-sort-*")
+	if err != nil {
+		return fmt.Errorf("failed to create sort run: %w", err)
+	}
+	s.runs = append(s.runs, &sortRun{file: file, seq: len(s.runs)})
+	w := bufio.NewWriter(file)
+	var buf []byte
+	for _, r := range s.rows {
+		buf = appendValues(buf[:0], r.keys)
+		buf = appendValues(buf, r.row)
+		if _, err := w.Write(buf); err != nil {
+			return fmt.Errorf("failed to write sort run: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write sort run: %w", err)
+	}
+	s.rows, s.size = nil, 0
+	return nil
+}
+
+func (s *sorter) compare(a, b []Value) int {
+	for i, key := range s.keys {
+		if c := key.compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (k sortKey) compare(a, b Value) int {
+	if a.IsNull() != b.IsNull() {
+		if a.IsNull() == k.nullsFirst {
+			return -1
+		}
+		return 1
+	}
+	c := CompareValues(a, b, k.expr.collation)
+	if k.desc {
+		return -c
+	}
+	return c
+}
+
+func (s *sorter) Row() Row {
+	return s.row
+}
+
+// Close removes the run files.
+func (s *sorter) Close() error {
+	var errs []error
+	for _, run := range s.runs {
+		errs = append(errs, run.file.Close(), os.Remove(run.file.Name()))
+	}
+	s.runs, s.merge.runs, s.rows = nil, nil, nil
+	s.loaded = true
+	errs = append(errs, s.src.Close())
+	return errors.Join(errs...)
+}
+
+// read decodes the next row of the run into head.
+func (r *sortRun) read(numKeys int) (bool, error) {
+	keys, err := readValues(r.reader)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read sort run: %w", err)
+	}
+	row, err := readValues(r.reader)
+	if err != nil || len(keys) != numKeys {
+		return false, fmt.Errorf("failed to read sort run: %w", errors.Join(err, io.ErrUnexpectedEOF))
+	}
+	r.head = sortedRow{keys: keys, row: row}
+	return true, nil
+}
+
+// runHeap orders the runs being merged by their head rows.
+type runHeap struct {
+	sorter *sorter
+	runs   []*sortRun
+}
+
+func (h *runHeap) Len() int { return len(h.runs) }
+
+func (h *runHeap) Less(i, j int) bool {
+	a, b := h.runs[i], h.runs[j]
+	if c := h.sorter.compare(a.head.keys, b.head.keys); c != 0 {
+		return c < 0
+	}
+	return a.seq < b.seq
+}
+
+func (h *runHeap) Swap(i, j int) { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+
+func (h *runHeap) Push(x any) { h.runs = append(h.runs, x.(*sortRun)) }
+
+func (h *runHeap) Pop() any {
+	run := h.runs[len(h.runs)-1]
+	h.runs = h.runs[:len(h.runs)-1]
+	return run
+}
+
+// valuesSize estimates the memory held by values.
+func valuesSize(values []Value) int {
+	size := 24
+	for _, v := range values {
+		size += 48 + len(v.Bytes)
+	}
+	return size
+}
+
+// appendValues encodes values for a sort run: a count, then for each value its
+// type and contents.
+func appendValues(buf []byte, values []Value) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(values)))
+	for _, v := range values {
+		buf = append(buf, byte(v.Type))
+		switch v.Type {
+		case TypeInteger:
+			buf = binary.AppendVarint(buf, v.Int)
+		case TypeReal:
+			buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(v.Real))
+		case TypeText, TypeBlob:
+			buf = binary.AppendUvarint(buf, uint64(len(v.Bytes)))
+			buf = append(buf, v.Bytes...)
+		}
+	}
+	return buf
+}
+
+func readValues(r *bufio.Reader) ([]Value, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]Value, n)
+	for i := range values {
+		t, err := r.ReadByte()
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		v := Value{Type: ValueType(t)}
+		switch v.Type {
+		case TypeInteger:
+			v.Int, err = binary.ReadVarint(r)
+		case TypeReal:
+			var b [8]byte
+			_, err = io.ReadFull(r, b[:])
+			v.Real = math.Float64frombits(binary.BigEndian.Uint64(b[:]))
+		case TypeText, TypeBlob:
+			var size uint64
+			if size, err = binary.ReadUvarint(r); err == nil {
+				v.Bytes = make([]byte, size)
+				_, err = io.ReadFull(r, v.Bytes)
+			}
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
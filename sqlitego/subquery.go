@@ -0,0 +1,347 @@
+package sqlitego
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// queryContext is what the expressions of a SELECT need beyond its columns:
+// the database that subqueries are planned against and, for a subquery, the
+// query around it.
+type queryContext struct {
+	pager   *Pager
+	catalog *Catalog
+	outer   *outerRow // nil for a statement that is not a subquery
+	with    *cteScope // the common tables in scope
+}
+
+// outerRow gives a subquery the columns of the query it is nested in. row is
+// the row of that query the subquery is being evaluated for.
+type outerRow struct {
+	scope *scope
+	row   Row
+	// correlated is set once the subquery, or one nested in it, reads a column
+	// of scope.
+	correlated bool
+}
+
+// compileOuterColumn resolves ref against the queries around s, innermost
+// first. Every subquery the reference crosses becomes correlated.
+func compileOuterColumn(ref *ColumnRef, s *scope) (*compiledExpr, error) {
+	if s.query == nil {
+		return nil, nil
+	}
+	var crossed []*outerRow
+	for link := s.query.outer; link != nil; link = link.scope.query.outer {
+		crossed = append(crossed, link)
+		idx, err := link.scope.resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		if idx < 0 {
+			continue
+		}
+		for _, l := range crossed {
+			l.correlated = true
+		}
+		if link.scope.reads != nil {
+			link.scope.reads[idx] = true
+		}
+		col := link.scope.columns[idx]
+		return &compiledExpr{
+			eval:      func(Row) (Value, error) { return link.row[idx], nil },
+			affinity:  col.Affinity,
+			collation: col.Collation,
+		}, nil
+	}
+	return nil, nil
+}
+
+// outerColumn looks ref up like compileOuterColumn, when it names no column or
+// alias of s, and returns the column with its value in the row of the query
+// around s that s is being planned for. ok is false while there is no such row,
+// as when a subquery is first planned.
+func (s *scope) outerColumn(ref *ColumnRef) (scopeColumn, Value, bool) {
+	if s.query == nil {
+		return scopeColumn{}, Value{}, false
+	}
+	if idx, err := s.resolve(ref); idx >= 0 || err != nil {
+		return scopeColumn{}, Value{}, false
+	}
+	if _, ok := s.aliases[strings.ToLower(ref.Column)]; ok && ref.Table == "" {
+		return scopeColumn{}, Value{}, false
+	}
+	for link := s.query.outer; link != nil; link = link.scope.query.outer {
+		idx, err := link.scope.resolve(ref)
+		if err != nil {
+			return scopeColumn{}, Value{}, false
+		}
+		if idx >= 0 {
+			if link.row == nil {
+				return scopeColumn{}, Value{}, false
+			}
+			return link.scope.columns[idx], link.row[idx], true
+		}
+	}
+	return scopeColumn{}, Value{}, false
+}
+
+// subquery is a SELECT nested in an expression. It is planned once when it is
+// compiled, to check it and to learn whether it is correlated, and then again
+// each time it runs.
+type subquery struct {
+	ctx     *queryContext
+	stmt    *SelectStmt
+	link    *outerRow
+	columns []outputColumn
+}
+
+func newSubquery(stmt *SelectStmt, s *scope) (*subquery, error) {
+	if s.query == nil {
+		return nil, fmt.Errorf("subqueries are not supported here")
+	}
+	link := &outerRow{scope: s}
+	ctx := &queryContext{pager: s.query.pager, catalog: s.query.catalog, outer: link, with: s.query.with}
+	q, err := planSelect(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.rows.Close(); err != nil {
+		return nil, err
+	}
+	return &subquery{ctx: ctx, stmt: stmt, link: link, columns: q.columns}, nil
+}
+
+// singleColumn checks that the subquery returns one column, as it must to be
+// used as a value.
+func (sq *subquery) singleColumn() error {
+	if len(sq.columns) != 1 {
+		return fmt.Errorf("sub-select returns %d columns - expected 1", len(sq.columns))
+	}
+	return nil
+}
+
+// run passes the subquery's rows, evaluated for the outer row, to each until
+// it returns false.
+func (sq *subquery) run(row Row, each func(Row) bool) error {
+	sq.link.row = row
+	q, err := planSelect(sq.ctx, sq.stmt)
+	if err != nil {
+		return err
+	}
+	for {
+		ok, err := q.rows.Next()
+		if err != nil {
+			return errors.Join(err, q.rows.Close())
+		}
+		if !ok || !each(q.rows.Row()) {
+			return q.rows.Close()
+		}
+	}
+}
+
+// cached evaluates a subquery result with compute, only once unless the
+// subquery is correlated.
+func (sq *subquery) cached(compute func(row Row) (Value, error)) func(row Row) (Value, error) {
+	var result *Value
+	return func(row Row) (Value, error) {
+		if result != nil {
+			return *result, nil
+		}
+		v, err := compute(row)
+		if err == nil && !sq.link.correlated {
+			result = &v
+		}
+		return v, err
+	}
+}
+
+// compileScalarSubquery evaluates "(SELECT ...)" to the first column of its
+// first row, or NULL.
+func compileScalarSubquery(e *SubqueryExpr, s *scope) (*compiledExpr, error) {
+	sq, err := newSubquery(e.Select, s)
+	if err != nil {
+		return nil, err
+	}
+	if err := sq.singleColumn(); err != nil {
+		return nil, err
+	}
+	return &compiledExpr{eval: sq.cached(func(row Row) (Value, error) {
+		v := NullValue()
+		err := sq.run(row, func(r Row) bool {
+			v = r[0]
+			return false
+		})
+		return v, err
+	}), affinity: sq.columns[0].affinity}, nil
+}
+
+func compileExists(e *ExistsExpr, s *scope) (*compiledExpr, error) {
+	sq, err := newSubquery(e.Select, s)
+	if err != nil {
+		return nil, err
+	}
+	return &compiledExpr{eval: sq.cached(func(row Row) (Value, error) {
+		found := false
+		err := sq.run(row, func(Row) bool {
+			found = true
+			return false
+		})
+		return boolValue(found), err
+	})}, nil
+}
+
+// compileInSubquery evaluates "x IN (SELECT ...)" against the set of values the
+// subquery returns, which is built once unless the subquery is correlated. As
+// in SQLite, both sides take one affinity, which is numeric when either side
+// is numeric, and are compared with the collation comparisonCollation picks for
+// x and the subquery's column.
+func compileInSubquery(e *InExpr, x *compiledExpr, s *scope) (*compiledExpr, error) {
+	sq, err := newSubquery(e.Select, s)
+	if err != nil {
+		return nil, err
+	}
+	if err := sq.singleColumn(); err != nil {
+		return nil, err
+	}
+	col := sq.columns[0]
+	affinity := inAffinity(x.affinity, col.affinity)
+	coll := comparisonCollation(x, &compiledExpr{collation: col.collation, explicit: col.explicit})
+	var set *rowSet
+	var empty, sawNull bool
+	return &compiledExpr{eval: func(row Row) (Value, error) {
+		if set == nil || sq.link.correlated {
+			set, empty, sawNull = newRowSet([]Collation{coll}), true, false
+			err := sq.run(row, func(r Row) bool {
+				empty = false
+				if r[0].IsNull() {
+					sawNull = true
+				} else {
+					set.add(Row{r[0].applyAffinity(affinity)})
+				}
+				return true
+			})
+			if err != nil {
+				set = nil
+				return Value{}, err
+			}
+		}
+		if empty {
+			return boolValue(e.Not), nil
+		}
+		v, err := x.eval(row)
+		if err != nil || v.IsNull() {
+			return v, err
+		}
+		if set.has(Row{v.applyAffinity(affinity)}) {
+			return boolValue(!e.Not), nil
+		}
+		if sawNull {
+			return NullValue(), nil
+		}
+		return boolValue(e.Not), nil
+	}}, nil
+}
+
+// inAffinity is the affinity both sides of "x IN (SELECT ...)" are converted to.
+// Two sides that both have an affinity are only converted when one is numeric.
+func inAffinity(x, col Affinity) Affinity {
+	switch {
+	case x.isNumeric() || col.isNumeric():
+		return AffinityNumeric
+	case x != AffinityNone && col != AffinityNone:
+		return AffinityBlob
+	case x == AffinityText || col == AffinityText:
+		return AffinityText
+	}
+	return AffinityNone
+}
+
+// derivedTable describes the planned rows of a subquery or common table in
+// FROM as a table called name, whose columns are the result columns. Columns
+// that share a name are renamed "name:1", "name:2" and so on, as SQLite does.
+func derivedTable(ref *TableRef, name string, q *query) (*fromTable, *scope) {
+	def := &TableDef{RowidAlias: -1}
+	s := &scope{}
+	seen := map[string]bool{}
+	suffix := 0
+	for _, col := range q.columns {
+		colName := col.Name
+		for seen[strings.ToLower(colName)] {
+			suffix++
+			colName = col.Name + ":" + strconv.Itoa(suffix)
+		}
+		seen[strings.ToLower(colName)] = true
+		def.Columns = append(def.Columns, ColumnDef{Name: colName, DeclType: col.DeclType, Affinity: col.affinity})
+		s.columns = append(s.columns, scopeColumn{Table: name, Name: colName, DeclType: col.DeclType, Affinity: col.affinity, Collation: col.collation})
+	}
+	// The rowid slot every table row ends with; a subquery has no rowid to name.
+	s.columns = append(s.columns, scopeColumn{Table: name, Name: "rowid", Hidden: true})
+	return &fromTable{ref: ref, def: def, query: q}, s
+}
+
+// derivedRows reads the rows of a subquery of FROM, each followed by the NULL
+// that stands in for a rowid.
+type derivedRows struct {
+	src rowSource
+}
+
+func (d *derivedRows) Next() (bool, error) {
+	return d.src.Next()
+}
+
+func (d *derivedRows) Row() Row {
+	return append(d.src.Row(), NullValue())
+}
+
+func (d *derivedRows) Close() error {
+	return d.src.Close()
+}
+
+func (d *derivedRows) rewind() bool {
+	return rewind(d.src)
+}
+
+// readAll reads the rows of src into memory and closes it.
+func readAll(src rowSource) ([]Row, error) {
+	rows := []Row{}
+	for {
+		ok, err := src.Next()
+		if err != nil {
+			return nil, errors.Join(err, src.Close())
+		}
+		if !ok {
+			return rows, src.Close()
+		}
+		rows = append(rows, src.Row())
+	}
+}
+
+// rowList passes on rows held in memory.
+type rowList struct {
+	rows []Row
+	pos  int
+}
+
+func (l *rowList) Next() (bool, error) {
+	if l.pos >= len(l.rows) {
+		return false, nil
+	}
+	l.pos++
+	return true, nil
+}
+
+func (l *rowList) Row() Row {
+	return append(Row(nil), l.rows[l.pos-1]...)
+}
+
+func (l *rowList) Close() error {
+	return nil
+}
+
+func (l *rowList) rewind() bool {
+	l.pos = 0
+	return true
+}
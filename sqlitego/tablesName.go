@@ -0,0 +1,20 @@
+package sqlitego
+
+import (
+	"slices"
+	"strings"
+)
+
+// tableNames lists the tables and views the way sqlite3's .tables does: sorted,
+// and without the names SQLite reserves for itself, which start with "sqlite_".
+func tableNames(catalog *Catalog) []string {
+	names := []string{}
+	for _, entry := range append(catalog.Tables(), catalog.Views()...) {
+		if len(entry.Name) > len("sqlite") && strings.EqualFold(entry.Name[:len("sqlite")], "sqlite") {
+			continue
+		}
+		names = append(names, entry.Name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,225 @@
+package sqlitego
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF      tokenKind = iota
+	tokIdent              // bare word or quoted identifier; keywords are bare words too
+	tokString             // 'text'
+	tokNumber             // integer, real or hex literal
+	tokBlob               // x'ABCD'
+	tokVariable           // ?, ?NNN, :name, @name, $name
+	tokOp                 // operators and punctuation
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // identifier and string contents are unquoted; everything else is source text
+	pos   int    // byte offsets of the token in the statement
+	end   int
+	quote byte // quote character of a quoted identifier, 0 for bare words
+}
+
+// SyntaxError reports where a statement stopped making sense.
+type SyntaxError struct {
+	SQL  string
+	Pos  int    // byte offset of the offending token
+	Near string // source text of the offending token, empty at end of input
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	line, col := lineAndColumn(e.SQL, e.Pos)
+	if e.Near == "" {
+		return fmt.Sprintf("syntax error at line %d, column %d: %s", line, col, e.Msg)
+	}
+	return fmt.Sprintf("syntax error at line %d, column %d near %q: %s", line, col, e.Near, e.Msg)
+}
+
+func lineAndColumn(sql string, pos int) (int, int) {
+	pos = min(pos, len(sql))
+	line := 1 + strings.Count(sql[:pos], "\n")
+	col := pos - strings.LastIndex(sql[:pos], "\n")
+	return line, col
+}
+
+// Multi-character operators, longest first so "<=" wins over "<".
+var operators = []string{"||", "<<", ">>", "<=", ">=", "==", "!=", "<>", "->>", "->",
+	"(", ")", ",", ";", ".", "*", "/", "%", "+", "-", "&", "|", "<", ">", "=", "~"}
+
+func tokenize(sql string) ([]token, error) {
+	var tokens []token
+	pos := 0
+	for {
+		pos = skipSpaceAndComments(sql, pos)
+		if pos >= len(sql) {
+			tokens = append(tokens, token{kind: tokEOF, pos: len(sql), end: len(sql)})
+			return tokens, nil
+		}
+		tok, err := nextToken(sql, pos)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		pos = tok.end
+	}
+}
+
+func skipSpaceAndComments(sql string, pos int) int {
+	for pos < len(sql) {
+		switch {
+		case strings.ContainsRune(" \t\n\r\f\v", rune(sql[pos])):
+			pos++
+		case strings.HasPrefix(sql[pos:], "--"):
+			end := strings.IndexByte(sql[pos:], '\n')
+			if end < 0 {
+				return len(sql)
+			}
+			pos += end + 1
+		case strings.HasPrefix(sql[pos:], "/*"):
+			end := strings.Index(sql[pos+2:], "*/")
+			if end < 0 {
+				return len(sql)
+			}
+			pos += end + 4
+		default:
+			return pos
+		}
+	}
+	return pos
+}
+
+func nextToken(sql string, pos int) (token, error) {
+	c := sql[pos]
+	switch {
+	case (c == 'x' || c == 'X') && pos+1 < len(sql) && sql[pos+1] == '\'':
+		tok, err := scanQuoted(sql, pos+1, '\'')
+		if err != nil {
+			return tok, err
+		}
+		if len(tok.text)%2 != 0 || strings.Trim(tok.text, "0123456789abcdefABCDEF") != "" {
+			return tok, &SyntaxError{SQL: sql, Pos: pos, Near: sql[pos:tok.end], Msg: "malformed blob literal"}
+		}
+		tok.kind, tok.pos = tokBlob, pos
+		return tok, nil
+	case isIdentStart(c):
+		end := pos + 1
+		for end < len(sql) && isIdentChar(sql[end]) {
+			end++
+		}
+		return token{kind: tokIdent, text: sql[pos:end], pos: pos, end: end}, nil
+	case c == '\'':
+		tok, err := scanQuoted(sql, pos, '\'')
+		tok.kind = tokString
+		return tok, err
+	case c == '"' || c == '`':
+		tok, err := scanQuoted(sql, pos, c)
+		tok.kind, tok.quote = tokIdent, c
+		return tok, err
+	case c == '[':
+		end := strings.IndexByte(sql[pos:], ']')
+		if end < 0 {
+			return token{}, &SyntaxError{SQL: sql, Pos: pos, Near: sql[pos:], Msg: "unterminated identifier"}
+		}
+		return token{kind: tokIdent, text: sql[pos+1 : pos+end], pos: pos, end: pos + end + 1, quote: '['}, nil
+	case isDigit(c) || (c == '.' && pos+1 < len(sql) && isDigit(sql[pos+1])):
+		return scanNumber(sql, pos)
+	case c == '?':
+		end := pos + 1
+		for end < len(sql) && isDigit(sql[end]) {
+			end++
+		}
+		return token{kind: tokVariable, text: sql[pos:end], pos: pos, end: end}, nil
+	case c == ':' || c == '@' || c == '$':
+		end := pos + 1
+		for end < len(sql) && isIdentChar(sql[end]) {
+			end++
+		}
+		if end == pos+1 {
+			return token{}, &SyntaxError{SQL: sql, Pos: pos, Near: string(c), Msg: "missing parameter name"}
+		}
+		return token{kind: tokVariable, text: sql[pos:end], pos: pos, end: end}, nil
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(sql[pos:], op) {
+			return token{kind: tokOp, text: op, pos: pos, end: pos + len(op)}, nil
+		}
+	}
+	return token{}, &SyntaxError{SQL: sql, Pos: pos, Near: string(c), Msg: "unrecognized token"}
+}
+
+// scanQuoted reads a quoted string or identifier starting at pos, where a doubled
+// quote character stands for itself.
+func scanQuoted(sql string, pos int, quote byte) (token, error) {
+	var sb strings.Builder
+	i := pos + 1
+	for i < len(sql) {
+		if sql[i] == quote {
+			if i+1 < len(sql) && sql[i+1] == quote {
+				sb.WriteByte(quote)
+				i += 2
+				continue
+			}
+			return token{text: sb.String(), pos: pos, end: i + 1}, nil
+		}
+		sb.WriteByte(sql[i])
+		i++
+	}
+	return token{}, &SyntaxError{SQL: sql, Pos: pos, Near: sql[pos:], Msg: "unterminated quoted string"}
+}
+
+func scanNumber(sql string, pos int) (token, error) {
+	end := pos
+	if strings.HasPrefix(sql[pos:], "0x") || strings.HasPrefix(sql[pos:], "0X") {
+		end += 2
+		for end < len(sql) && strings.IndexByte("0123456789abcdefABCDEF", sql[end]) >= 0 {
+			end++
+		}
+		if end == pos+2 {
+			return token{}, &SyntaxError{SQL: sql, Pos: pos, Near: sql[pos:end], Msg: "malformed hex literal"}
+		}
+	} else {
+		for end < len(sql) && isDigit(sql[end]) {
+			end++
+		}
+		if end < len(sql) && sql[end] == '.' {
+			end++
+			for end < len(sql) && isDigit(sql[end]) {
+				end++
+			}
+		}
+		if end < len(sql) && (sql[end] == 'e' || sql[end] == 'E') {
+			exp := end + 1
+			if exp < len(sql) && (sql[exp] == '+' || sql[exp] == '-') {
+				exp++
+			}
+			if exp < len(sql) && isDigit(sql[exp]) {
+				end = exp
+				for end < len(sql) && isDigit(sql[end]) {
+					end++
+				}
+			}
+		}
+	}
+	if end < len(sql) && isIdentChar(sql[end]) {
+		return token{}, &SyntaxError{SQL: sql, Pos: pos, Near: sql[pos : end+1], Msg: "unrecognized token"}
+	}
+	return token{kind: tokNumber, text: sql[pos:end], pos: pos, end: end}, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$'
+}
@@ -0,0 +1,133 @@
+package sqlitego
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+type Record struct {
+	Values []Value
+}
+
+// decodeRecord parses a complete record payload: a header of serial types
+// followed by the body holding each column value.
+func decodeRecord(payload []byte) (Record, error) {
+	return decodeRecordColumns(func(n int) ([]byte, error) { return payload[:n], nil }, len(payload), -1)
+}
+
+// decodeRecordColumns parses the first columns values of a record of size
+// bytes, or all of them when columns is negative. read returns the first n
+// bytes of the record, and is asked for no more than those values need.
+func decodeRecordColumns(read func(n int) ([]byte, error), size int, columns int) (Record, error) {
+	head, err := read(min(size, 9))
+	if err != nil {
+		return Record{}, err
+	}
+	headerSize, n := readVarint(head)
+	if n == 0 || headerSize < n || headerSize > size {
+		return Record{}, fmt.Errorf("invalid record header size %d", headerSize)
+	}
+	if head, err = read(headerSize); err != nil {
+		return Record{}, err
+	}
+	pos := n
+
+	serialTypes := []int{}
+	bodySize := 0
+	for pos < headerSize && (columns < 0 || len(serialTypes) < columns) {
+		serial, n := readVarint(head[pos:headerSize])
+		if n == 0 {
+			return Record{}, errors.New("truncated record header")
+		}
+		serialTypes = append(serialTypes, serial)
+		bodySize += serialTypeSize(serial)
+		pos += n
+	}
+	if headerSize+bodySize > size {
+		return Record{}, fmt.Errorf("record body is shorter than its header describes")
+	}
+	payload, err := read(headerSize + bodySize)
+	if err != nil {
+		return Record{}, err
+	}
+
+	values := make([]Value, 0, len(serialTypes))
+	bodyPos := headerSize
+	for _, st := range serialTypes {
+		val, size := readValueBySerialType(payload[bodyPos:], st)
+		values = append(values, val)
+		bodyPos += size
+	}
+	return Record{Values: values}, nil
+}
+
+// Trả về giá trị varint và số byte đã đọc
+func readVarint(data []byte) (int, int) {
+	var result int
+	for i := 0; i < 8 && i < len(data); i++ {
+		b := data[i]
+		result = (result << 7) | int(b&0x7F)
+		if b&0x80 == 0 {
+			return result, i + 1
+		}
+	}
+	// Nếu không gặp byte kết thúc, byte thứ 9 là toàn bộ
+	if len(data) >= 9 {
+		b := data[8]
+		result = (result << 8) | int(b)
+		return result, 9
+	}
+	return 0, 0 // lỗi
+}
+
+// serialTypeSize returns the number of body bytes used by a value of serialType.
+func serialTypeSize(serialType int) int {
+	switch serialType {
+	case 0, 8, 9, 10, 11:
+		return 0
+	case 5:
+		return 6
+	case 6, 7:
+		return 8
+	}
+	if serialType >= 12 {
+		return (serialType - 12) / 2
+	}
+	return serialType
+}
+
+// readValueBySerialType decodes one record value and returns it with the number
+// of body bytes it occupied.
+func readValueBySerialType(data []byte, serialType int) (Value, int) {
+	size := serialTypeSize(serialType)
+	if len(data) < size {
+		return NullValue(), 0
+	}
+	switch serialType {
+	case 0:
+		return NullValue(), 0
+	case 1, 2, 3, 4, 5, 6:
+		// Big-endian two's complement integer of 1, 2, 3, 4, 6 or 8 bytes
+		val := int64(int8(data[0]))
+		for _, b := range data[1:size] {
+			val = val<<8 | int64(b)
+		}
+		return IntegerValue(val), size
+	case 7:
+		bits := binary.BigEndian.Uint64(data)
+		return RealValue(math.Float64frombits(bits)), 8
+	case 8:
+		return IntegerValue(0), 0
+	case 9:
+		return IntegerValue(1), 0
+	}
+	if serialType >= 12 {
+		if serialType%2 == 0 {
+			return BlobValue(data[:size]), size
+		}
+		return Value{Type: TypeText, Bytes: data[:size]}, size
+	}
+	return NullValue(), 0 // reserved serial types 10 and 11
+}
@@ -0,0 +1,428 @@
+package sqlitego
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ValueType is the storage class of a value, as defined by SQLite.
+type ValueType uint8
+
+const (
+	TypeNull ValueType = iota
+	TypeInteger
+	TypeReal
+	TypeText
+	TypeBlob
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case TypeInteger:
+		return "integer"
+	case TypeReal:
+		return "real"
+	case TypeText:
+		return "text"
+	case TypeBlob:
+		return "blob"
+	}
+	return "null"
+}
+
+// Value is a single SQLite value. Int is set for INTEGER, Real for REAL, and Bytes
+// holds the raw contents of TEXT (UTF-8) and BLOB values.
+type Value struct {
+	Type  ValueType
+	Int   int64
+	Real  float64
+	Bytes []byte
+}
+
+func NullValue() Value {
+	return Value{Type: TypeNull}
+}
+
+func IntegerValue(i int64) Value {
+	return Value{Type: TypeInteger, Int: i}
+}
+
+func RealValue(f float64) Value {
+	return Value{Type: TypeReal, Real: f}
+}
+
+func TextValue(s string) Value {
+	return Value{Type: TypeText, Bytes: []byte(s)}
+}
+
+func BlobValue(b []byte) Value {
+	return Value{Type: TypeBlob, Bytes: b}
+}
+
+func (v Value) IsNull() bool {
+	return v.Type == TypeNull
+}
+
+func (v Value) isNumeric() bool {
+	return v.Type == TypeInteger || v.Type == TypeReal
+}
+
+func (v Value) float() float64 {
+	if v.Type == TypeInteger {
+		return float64(v.Int)
+	}
+	return v.Real
+}
+
+// String renders the value the way the sqlite3 shell does in list mode: NULL is
+// empty, REAL uses "%!.15g" and TEXT/BLOB are printed as-is.
+func (v Value) String() string {
+	switch v.Type {
+	case TypeInteger:
+		return strconv.FormatInt(v.Int, 10)
+	case TypeReal:
+		return formatReal(v.Real)
+	case TypeText, TypeBlob:
+		return string(v.Bytes)
+	}
+	return ""
+}
+
+func formatReal(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case f == 0:
+		return "0.0"
+	}
+	s := strconv.FormatFloat(f, 'g', 15, 64)
+	if strings.ContainsAny(s, ".n") {
+		return s
+	}
+	// The "!" flag always keeps a decimal point, even for integral values.
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		return s[:i] + ".0" + s[i:]
+	}
+	return s + ".0"
+}
+
+// Affinity is the preferred storage class of a column (section 3 of "Datatypes In
+// SQLite"). Expressions other than columns have AffinityNone, which differs from
+// the BLOB affinity of a column declared without a type when values are compared.
+type Affinity uint8
+
+const (
+	AffinityNone Affinity = iota
+	AffinityBlob
+	AffinityText
+	AffinityNumeric
+	AffinityInteger
+	AffinityReal
+)
+
+// affinityFromDeclType applies the rules of section 3.1 to a declared column type.
+func affinityFromDeclType(declType string) Affinity {
+	t := strings.ToUpper(declType)
+	switch {
+	case strings.Contains(t, "INT"):
+		return AffinityInteger
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return AffinityText
+	case strings.Contains(t, "BLOB"), strings.TrimSpace(t) == "":
+		return AffinityBlob
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return AffinityReal
+	}
+	return AffinityNumeric
+}
+
+func (a Affinity) isNumeric() bool {
+	return a == AffinityNumeric || a == AffinityInteger || a == AffinityReal
+}
+
+// applyAffinity converts v the way SQLite does when storing it in a column of
+// affinity a.
+func (v Value) applyAffinity(a Affinity) Value {
+	switch a {
+	case AffinityText:
+		if v.isNumeric() {
+			return TextValue(v.String())
+		}
+	case AffinityNumeric, AffinityInteger:
+		switch v.Type {
+		case TypeText:
+			if n, ok := parseNumericText(string(v.Bytes)); ok {
+				return n
+			}
+		case TypeReal:
+			if i, ok := realAsInteger(v.Real); ok {
+				return IntegerValue(i)
+			}
+		}
+	case AffinityReal:
+		switch v.Type {
+		case TypeText:
+			if n, ok := parseNumericText(string(v.Bytes)); ok {
+				return RealValue(n.float())
+			}
+		case TypeInteger:
+			return RealValue(float64(v.Int))
+		}
+	}
+	return v
+}
+
+// parseNumericText reports whether s is a well-formed integer or real literal
+// (surrounding spaces allowed) and returns it as an INTEGER when that is lossless.
+func parseNumericText(s string) (Value, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Value{}, false
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return IntegerValue(i), true
+	}
+	if strings.ContainsAny(s, "xXpP_iInN") {
+		// Reject hex floats, underscores, Inf and NaN, which ParseFloat accepts.
+		return Value{}, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil && !isRangeError(err) {
+		return Value{}, false
+	}
+	if i, ok := realAsInteger(f); ok {
+		return IntegerValue(i), true
+	}
+	return RealValue(f), true
+}
+
+// numericPrefix converts TEXT the way SQLite does in arithmetic: the longest prefix
+// that looks like a number is used, and text without one is 0.
+func numericPrefix(s string) Value {
+	s = strings.TrimLeft(s, " \t\n\r\f\v")
+	end, isReal := 0, false
+	if end < len(s) && (s[end] == '+' || s[end] == '-') {
+		end++
+	}
+	digits := end
+	for end < len(s) && isDigit(s[end]) {
+		end++
+	}
+	if end < len(s) && s[end] == '.' {
+		isReal = true
+		end++
+		for end < len(s) && isDigit(s[end]) {
+			end++
+		}
+	}
+	if end == digits || end == digits+1 && isReal {
+		return IntegerValue(0)
+	}
+	if end < len(s) && (s[end] == 'e' || s[end] == 'E') {
+		exp := end + 1
+		if exp < len(s) && (s[exp] == '+' || s[exp] == '-') {
+			exp++
+		}
+		if exp < len(s) && isDigit(s[exp]) {
+			isReal = true
+			for end = exp; end < len(s) && isDigit(s[end]); end++ {
+			}
+		}
+	}
+	if !isReal {
+		if i, err := strconv.ParseInt(s[:end], 10, 64); err == nil {
+			return IntegerValue(i)
+		}
+	}
+	f, _ := strconv.ParseFloat(s[:end], 64)
+	return RealValue(f)
+}
+
+func isRangeError(err error) bool {
+	numErr, ok := err.(*strconv.NumError)
+	return ok && numErr.Err == strconv.ErrRange
+}
+
+// realAsInteger returns f as an int64 when the conversion is exact.
+func realAsInteger(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < -9.223372036854775e18 || f >= 9.223372036854775e18 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// Collation compares two TEXT values.
+type Collation func(a, b []byte) int
+
+func binaryCollation(a, b []byte) int {
+	return bytes.Compare(a, b)
+}
+
+// nocaseCollation folds only ASCII letters, like SQLite's built-in NOCASE.
+func nocaseCollation(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		ca, cb := asciiLower(a[i]), asciiLower(b[i])
+		if ca != cb {
+			if ca < cb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+func rtrimCollation(a, b []byte) int {
+	return bytes.Compare(bytes.TrimRight(a, " "), bytes.TrimRight(b, " "))
+}
+
+func asciiLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+var collations = map[string]Collation{
+	"BINARY": binaryCollation,
+	"NOCASE": nocaseCollation,
+	"RTRIM":  rtrimCollation,
+}
+
+// sameCollation reports whether a and b are the same collation, taking nil as
+// BINARY.
+func sameCollation(a, b Collation) bool {
+	if a == nil {
+		a = binaryCollation
+	}
+	if b == nil {
+		b = binaryCollation
+	}
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+func lookupCollation(name string) (Collation, bool) {
+	coll, ok := collations[strings.ToUpper(name)]
+	return coll, ok
+}
+
+// CompareValues orders two values using SQLite's rules: NULL < INTEGER/REAL <
+// TEXT < BLOB, numbers compare numerically, TEXT uses coll (BINARY when nil) and
+// BLOBs compare with memcmp.
+func CompareValues(a, b Value, coll Collation) int {
+	ca, cb := a.typeClass(), b.typeClass()
+	if ca != cb {
+		return ca - cb
+	}
+	switch a.Type {
+	case TypeNull:
+		return 0
+	case TypeInteger, TypeReal:
+		return compareNumbers(a, b)
+	case TypeText:
+		if coll == nil {
+			coll = binaryCollation
+		}
+		return sign(coll(a.Bytes, b.Bytes))
+	}
+	return bytes.Compare(a.Bytes, b.Bytes)
+}
+
+func (v Value) typeClass() int {
+	switch v.Type {
+	case TypeInteger, TypeReal:
+		return 1
+	case TypeText:
+		return 2
+	case TypeBlob:
+		return 3
+	}
+	return 0
+}
+
+func compareNumbers(a, b Value) int {
+	if a.Type == TypeInteger && b.Type == TypeInteger {
+		switch {
+		case a.Int < b.Int:
+			return -1
+		case a.Int > b.Int:
+			return 1
+		}
+		return 0
+	}
+	if a.Type == TypeInteger {
+		return -compareIntReal(b.Real, a.Int)
+	}
+	if b.Type == TypeInteger {
+		return compareIntReal(a.Real, b.Int)
+	}
+	switch {
+	case a.Real < b.Real:
+		return -1
+	case a.Real > b.Real:
+		return 1
+	}
+	return 0
+}
+
+// compareIntReal compares a REAL with an INTEGER without losing precision on
+// integers beyond 2^53.
+func compareIntReal(r float64, i int64) int {
+	if math.IsNaN(r) {
+		return -1
+	}
+	if r < -9.223372036854775808e18 {
+		return -1
+	}
+	if r >= 9.223372036854775808e18 {
+		return 1
+	}
+	t := int64(r)
+	switch {
+	case t < i:
+		return -1
+	case t > i:
+		return 1
+	}
+	frac := r - float64(t)
+	switch {
+	case frac < 0:
+		return -1
+	case frac > 0:
+		return 1
+	}
+	return 0
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// prepareComparison applies the affinity conversions of section 4.2 before two
+// operands of a comparison are compared. As in sqlite3CompareAffinity, TEXT
+// affinity only converts an operand that has no affinity at all, not a column
+// with BLOB affinity.
+func prepareComparison(a Value, affA Affinity, b Value, affB Affinity) (Value, Value) {
+	switch {
+	case affA.isNumeric() && !affB.isNumeric():
+		b = b.applyAffinity(AffinityNumeric)
+	case affB.isNumeric() && !affA.isNumeric():
+		a = a.applyAffinity(AffinityNumeric)
+	case affA == AffinityText && affB == AffinityNone:
+		b = b.applyAffinity(AffinityText)
+	case affB == AffinityText && affA == AffinityNone:
+		a = a.applyAffinity(AffinityText)
+	}
+	return a, b
+}
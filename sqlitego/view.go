@@ -0,0 +1,39 @@
+package sqlitego
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// planView plans the rows of a view. Its SELECT stands on its own: it sees
+// neither the common tables nor the columns of the statement that reads it.
+func planView(ctx *queryContext, view SchemaEntry) (*query, error) {
+	catalog := ctx.catalog
+	def, err := catalog.ViewDef(view)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.ToLower(view.Name)
+	if catalog.expanding[key] {
+		return nil, fmt.Errorf("view %s is circularly defined", view.Name)
+	}
+	if catalog.expanding == nil {
+		catalog.expanding = make(map[string]bool)
+	}
+	catalog.expanding[key] = true
+	defer delete(catalog.expanding, key)
+
+	q, err := planSelect(&queryContext{pager: ctx.pager, catalog: catalog}, def.Select)
+	if err != nil || len(def.Columns) == 0 {
+		return q, err
+	}
+	if len(def.Columns) != len(q.columns) {
+		err := fmt.Errorf("expected %d columns for '%s' but got %d", len(def.Columns), view.Name, len(q.columns))
+		return nil, errors.Join(err, q.rows.Close())
+	}
+	for i := range q.columns {
+		q.columns[i].Name = def.Columns[i]
+	}
+	return q, nil
+}
@@ -0,0 +1,655 @@
+package sqlitego
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// windowFunc describes a built-in window function that is not an aggregate.
+// framed marks the functions that read the rows of the frame; the others read
+// the whole partition.
+type windowFunc struct {
+	minArgs, maxArgs int
+	framed           bool
+}
+
+var windowFuncs = map[string]windowFunc{
+	"row_number":   {0, 0, false},
+	"rank":         {0, 0, false},
+	"dense_rank":   {0, 0, false},
+	"percent_rank": {0, 0, false},
+	"cume_dist":    {0, 0, false},
+	"ntile":        {1, 1, false},
+	"lag":          {1, 3, false},
+	"lead":         {1, 3, false},
+	"first_value":  {1, 1, true},
+	"last_value":   {1, 1, true},
+	"nth_value":    {2, 2, true},
+}
+
+// defaultFrame is the frame of a window that names none: the rows up to the
+// current row and its peers.
+var defaultFrame = FrameSpec{Units: "RANGE", Start: FrameBound{Kind: "UNBOUNDED PRECEDING"}, End: FrameBound{Kind: "CURRENT ROW"}}
+
+// windowContext collects the window function calls of the SELECT list and
+// ORDER BY. Their results follow the columns of the rows they are computed for,
+// from offset on, as aggregate results follow the columns of aggregated rows.
+type windowContext struct {
+	stmt    *SelectStmt // for the windows of its WINDOW clause
+	input   *scope      // compiles arguments and window definitions
+	windows []*window   // in the order they are first used
+	calls   int
+	offset  int // set once every call is compiled
+}
+
+// window is one window definition and the calls made over it.
+type window struct {
+	spec      *WindowSpec
+	partition []*compiledExpr
+	order     []sortKey
+	frame     FrameSpec
+	start     *compiledExpr // offset of the frame start; nil when it has none
+	end       *compiledExpr // offset of the frame end; nil when it has none
+	calls     []*windowCall
+}
+
+// windowCall is one window function call. Its result is stored at position
+// offset+slot of the rows.
+type windowCall struct {
+	name string
+	fn   windowFunc
+	agg  *aggregateCall // set for an aggregate function used over a window
+	args []*compiledExpr
+	slot int
+}
+
+// newWindowContext checks the windows of the WINDOW clause of stmt, even
+// those no call uses.
+func newWindowContext(stmt *SelectStmt, input *scope) (*windowContext, error) {
+	w := &windowContext{stmt: stmt, input: input}
+	for i, named := range stmt.Windows {
+		if _, err := w.resolve(named.Spec, "", i); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (w *windowContext) add(e *FuncCall) (*compiledExpr, error) {
+	name := strings.ToLower(e.Name)
+	fn, isWindow := windowFuncs[name]
+	aggFn, isAgg := aggregateFuncs[name]
+	if !isWindow && (!isAgg || len(e.Args) > 1 && (name == "min" || name == "max")) {
+		return nil, fmt.Errorf("%s() may not be used as a window function", e.Name)
+	}
+	if e.Distinct {
+		return nil, fmt.Errorf("DISTINCT is not supported for window functions")
+	}
+	if isAgg {
+		fn.minArgs, fn.maxArgs, fn.framed = aggFn.minArgs, aggFn.maxArgs, true
+	}
+	if e.Star && name != "count" || len(e.Args) < fn.minArgs || len(e.Args) > fn.maxArgs {
+		return nil, fmt.Errorf("wrong number of arguments to function %s()", e.Name)
+	}
+	spec, err := w.resolve(e.Over, e.Window, len(w.stmt.Windows))
+	if err != nil {
+		return nil, err
+	}
+	win, err := w.window(spec)
+	if err != nil {
+		return nil, err
+	}
+	call := &windowCall{name: name, fn: fn, slot: w.calls}
+	for _, arg := range e.Args {
+		compiled, err := compileExpr(arg, w.input)
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, compiled)
+	}
+	if isAgg {
+		call.agg = &aggregateCall{name: name, fn: aggFn, args: call.args}
+	}
+	win.calls = append(win.calls, call)
+	w.calls++
+	slot := call.slot
+	return &compiledExpr{eval: func(row Row) (Value, error) { return row[w.offset+slot], nil }}, nil
+}
+
+// resolve returns the window of "OVER (spec)" or "OVER name", with the named
+// windows it builds on merged in. Only the first named windows of the WINDOW
+// clause may be used, so that a window cannot build on itself.
+func (w *windowContext) resolve(spec *WindowSpec, name string, named int) (*WindowSpec, error) {
+	if spec == nil || spec.Base != "" {
+		if spec != nil {
+			name = spec.Base
+		}
+		i := slices.IndexFunc(w.stmt.Windows[:named], func(nw NamedWindow) bool { return strings.EqualFold(nw.Name, name) })
+		if i < 0 {
+			return nil, fmt.Errorf("no such window: %s", name)
+		}
+		base, err := w.resolve(w.stmt.Windows[i].Spec, "", i)
+		if err != nil || spec == nil {
+			return base, err
+		}
+		switch {
+		case len(spec.PartitionBy) > 0:
+			return nil, fmt.Errorf("cannot override PARTITION clause of window: %s", name)
+		case base.OrderBy != nil && spec.OrderBy != nil:
+			return nil, fmt.Errorf("cannot override ORDER BY clause of window: %s", name)
+		case base.Frame != nil:
+			return nil, fmt.Errorf("cannot override frame specification of window: %s", name)
+		}
+		merged := &WindowSpec{PartitionBy: base.PartitionBy, OrderBy: base.OrderBy, Frame: spec.Frame}
+		if spec.OrderBy != nil {
+			merged.OrderBy = spec.OrderBy
+		}
+		return merged, nil
+	}
+	return spec, nil
+}
+
+// window returns the window of spec, which calls over the same definition
+// share.
+func (w *windowContext) window(spec *WindowSpec) (*window, error) {
+	for _, win := range w.windows {
+		if reflect.DeepEqual(win.spec, spec) {
+			return win, nil
+		}
+	}
+	win := &window{spec: spec, frame: defaultFrame}
+	for _, expr := range spec.PartitionBy {
+		compiled, err := compileExpr(expr, w.input)
+		if err != nil {
+			return nil, err
+		}
+		win.partition = append(win.partition, compiled)
+	}
+	for _, term := range spec.OrderBy {
+		compiled, err := compileExpr(term.Expr, w.input)
+		if err != nil {
+			return nil, err
+		}
+		win.order = append(win.order, sortKey{expr: compiled, desc: term.Desc, nullsFirst: nullsFirst(term)})
+	}
+	if spec.Frame != nil {
+		win.frame = *spec.Frame
+	}
+	if win.frame.Units == "RANGE" && (win.frame.Start.Offset != nil || win.frame.End.Offset != nil) && len(win.order) != 1 {
+		return nil, fmt.Errorf("RANGE with offset PRECEDING/FOLLOWING requires one ORDER BY expression")
+	}
+	// Offsets are constant: they cannot refer to columns.
+	var err error
+	if win.frame.Start.Offset != nil {
+		if win.start, err = compileExpr(win.frame.Start.Offset, &scope{}); err != nil {
+			return nil, err
+		}
+	}
+	if win.frame.End.Offset != nil {
+		if win.end, err = compileExpr(win.frame.End.Offset, &scope{}); err != nil {
+			return nil, err
+		}
+	}
+	w.windows = append(w.windows, win)
+	return win, nil
+}
+
+// rows computes the window calls for the rows of src. The windows run one
+// after the other, the last one first, each over the rows sorted by its
+// partition and order, so that the rows come out in the order of the first.
+// ordered tells that src already follows the order of the last window.
+func (w *windowContext) rows(src rowSource, ordered bool) rowSource {
+	for i := len(w.windows) - 1; i >= 0; i-- {
+		win := w.windows[i]
+		if keys := win.sortKeys(); len(keys) > 0 && !(ordered && i == len(w.windows)-1) {
+			src = newSorter(src, keys)
+		}
+		src = &windowRows{src: src, ctx: w, win: win}
+	}
+	return src
+}
+
+func (win *window) sortKeys() []sortKey {
+	var keys []sortKey
+	for _, expr := range win.partition {
+		keys = append(keys, sortKey{expr: expr, nullsFirst: true})
+	}
+	return append(keys, win.order...)
+}
+
+// windowRows computes the calls of one window. Its source delivers the rows of
+// a partition next to each other; it reads them all before passing them on.
+type windowRows struct {
+	src rowSource
+	ctx *windowContext
+	win *window
+
+	started bool
+	pending Row // first row of the next partition, already read from src
+	keys    []Value
+	rows    []Row
+	pos     int
+}
+
+func (w *windowRows) Next() (bool, error) {
+	if w.pos < len(w.rows) {
+		w.pos++
+		return true, nil
+	}
+	if !w.started {
+		w.started = true
+		if err := w.advance(); err != nil {
+			return false, err
+		}
+	}
+	if w.pending == nil {
+		return false, nil
+	}
+	w.rows = w.rows[:0]
+	keys := w.keys
+	for w.pending != nil && sameKeys(keys, w.keys, w.win.partition) {
+		w.rows = append(w.rows, w.pending)
+		if err := w.advance(); err != nil {
+			return false, err
+		}
+	}
+	if err := w.compute(); err != nil {
+		return false, err
+	}
+	w.pos = 1
+	return true, nil
+}
+
+// advance reads the next row into pending, widened to hold the call results,
+// and its partition keys into keys.
+func (w *windowRows) advance() error {
+	ok, err := w.src.Next()
+	if err != nil || !ok {
+		w.pending = nil
+		return err
+	}
+	row := w.src.Row()
+	if width := w.ctx.offset + w.ctx.calls; len(row) < width {
+		row = append(row, make(Row, width-len(row))...)
+	}
+	keys := make([]Value, len(w.win.partition))
+	for i, expr := range w.win.partition {
+		if keys[i], err = expr.eval(row); err != nil {
+			return err
+		}
+	}
+	w.pending, w.keys = row, keys
+	return nil
+}
+
+func (w *windowRows) Row() Row {
+	return append(Row(nil), w.rows[w.pos-1]...)
+}
+
+func (w *windowRows) Close() error {
+	w.rows = nil
+	return w.src.Close()
+}
+
+// partition is a partition of rows being computed. Rows whose ORDER BY values
+// are equal are peers; group numbers the runs of peers, and first and last
+// hold the first and last row of each.
+type partition struct {
+	rows        []Row
+	keys        []sortKey // the ORDER BY of the window
+	order       [][]Value // the ORDER BY values of each row
+	group       []int
+	first, last []int
+	// spec is the frame, and start and end the values of its offsets.
+	spec       FrameSpec
+	start, end Value
+}
+
+func (w *windowRows) compute() error {
+	p := &partition{rows: w.rows, keys: w.win.order, order: make([][]Value, len(w.rows)), group: make([]int, len(w.rows)), spec: w.win.frame}
+	for i, row := range p.rows {
+		p.order[i] = make([]Value, len(w.win.order))
+		for k, key := range w.win.order {
+			v, err := key.expr.eval(row)
+			if err != nil {
+				return err
+			}
+			p.order[i][k] = v
+		}
+		if i == 0 || !p.peers(i-1, i) {
+			p.first = append(p.first, i)
+			p.last = append(p.last, i)
+		}
+		p.group[i] = len(p.first) - 1
+		p.last[p.group[i]] = i
+	}
+	var err error
+	if p.start, p.end, err = w.offsets(); err != nil {
+		return err
+	}
+	for _, call := range w.win.calls {
+		args := make([][]Value, len(p.rows))
+		for i, row := range p.rows {
+			args[i] = make([]Value, len(call.args))
+			for k, arg := range call.args {
+				if args[i][k], err = arg.eval(row); err != nil {
+					return err
+				}
+			}
+		}
+		slot := w.ctx.offset + call.slot
+		if call.agg != nil {
+			if err := p.aggregate(call, args, func(i int, v Value) { p.rows[i][slot] = v }); err != nil {
+				return err
+			}
+			continue
+		}
+		for i := range p.rows {
+			var v Value
+			if call.fn.framed {
+				v, err = p.framed(call, args, i)
+			} else {
+				v, err = p.ranking(call, args, i)
+			}
+			if err != nil {
+				return err
+			}
+			p.rows[i][slot] = v
+		}
+	}
+	return nil
+}
+
+func (p *partition) peers(i, j int) bool {
+	for k, key := range p.keys {
+		if key.compare(p.order[i][k], p.order[j][k]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// offsets evaluates the offsets of the frame, which must not be negative.
+func (w *windowRows) offsets() (start, end Value, err error) {
+	check := func(expr *compiledExpr, which string) (Value, error) {
+		if expr == nil {
+			return Value{}, nil
+		}
+		v, err := expr.eval(nil)
+		if err != nil {
+			return v, err
+		}
+		v = v.applyAffinity(AffinityNumeric)
+		if w.win.frame.Units == "RANGE" {
+			if !v.isNumeric() || v.float() < 0 {
+				return v, fmt.Errorf("frame %s offset must be a non-negative number", which)
+			}
+		} else if v.Type != TypeInteger || v.Int < 0 {
+			return v, fmt.Errorf("frame %s offset must be a non-negative integer", which)
+		}
+		return v, nil
+	}
+	if start, err = check(w.win.start, "starting"); err != nil {
+		return
+	}
+	end, err = check(w.win.end, "ending")
+	return
+}
+
+// ranking computes a function that reads the whole partition for row i.
+func (p *partition) ranking(call *windowCall, args [][]Value, i int) (Value, error) {
+	n := len(p.rows)
+	switch call.name {
+	case "row_number":
+		return IntegerValue(int64(i + 1)), nil
+	case "rank":
+		return IntegerValue(int64(p.first[p.group[i]] + 1)), nil
+	case "dense_rank":
+		return IntegerValue(int64(p.group[i] + 1)), nil
+	case "percent_rank":
+		if n == 1 {
+			return RealValue(0), nil
+		}
+		return RealValue(float64(p.first[p.group[i]]) / float64(n-1)), nil
+	case "cume_dist":
+		return RealValue(float64(p.last[p.group[i]]+1) / float64(n)), nil
+	case "ntile":
+		buckets := castValue(args[i][0], AffinityInteger)
+		if buckets.Type != TypeInteger || buckets.Int <= 0 {
+			return Value{}, fmt.Errorf("argument of ntile must be a positive integer")
+		}
+		// The first n%buckets buckets take one row more than the others.
+		size, extra := int64(n)/buckets.Int, int64(n)%buckets.Int
+		if size == 0 {
+			return IntegerValue(int64(i + 1)), nil
+		}
+		big := extra * (size + 1)
+		if int64(i) < big {
+			return IntegerValue(int64(i)/(size+1) + 1), nil
+		}
+		return IntegerValue(extra + (int64(i)-big)/size + 1), nil
+	}
+	// lag and lead. An offset that is not a whole number gives NULL.
+	offset := int64(1)
+	if len(args[i]) > 1 {
+		v := args[i][1]
+		if v.IsNull() || v.Type == TypeReal && v.Real != float64(int64(v.Real)) {
+			return NullValue(), nil
+		}
+		offset = castValue(v, AffinityInteger).Int
+	}
+	if call.name == "lag" {
+		offset = -offset
+	}
+	if j := int64(i) + offset; j >= 0 && j < int64(n) {
+		return args[j][0], nil
+	}
+	if len(args[i]) > 2 {
+		return args[i][2], nil
+	}
+	return NullValue(), nil
+}
+
+// framed computes first_value, last_value or nth_value over the frame of row i.
+func (p *partition) framed(call *windowCall, args [][]Value, i int) (Value, error) {
+	lo, hi := p.frame(i)
+	nth := 1
+	switch call.name {
+	case "last_value":
+		for j := hi; j >= lo; j-- {
+			if !p.excluded(i, j) {
+				return args[j][0], nil
+			}
+		}
+		return NullValue(), nil
+	case "nth_value":
+		v := args[i][1].applyAffinity(AffinityNumeric)
+		if v.Type != TypeInteger || v.Int <= 0 {
+			return Value{}, fmt.Errorf("second argument to nth_value must be a positive integer")
+		}
+		nth = int(min(v.Int, int64(len(p.rows)+1)))
+	}
+	for j := lo; j <= hi; j++ {
+		if p.excluded(i, j) {
+			continue
+		}
+		if nth--; nth == 0 {
+			return args[j][0], nil
+		}
+	}
+	return NullValue(), nil
+}
+
+// aggregate computes an aggregate function over the frame of every row. When
+// the frame always starts at the first row and leaves no row out, it only
+// ever grows, and one accumulator serves all rows.
+func (p *partition) aggregate(call *windowCall, args [][]Value, set func(i int, v Value)) error {
+	running := p.spec.Start.Kind == "UNBOUNDED PRECEDING" && p.spec.Exclude == ""
+	acc := call.agg.newAccumulator()
+	stepped := -1
+	for i := range p.rows {
+		lo, hi := p.frame(i)
+		if !running {
+			acc, stepped = call.agg.newAccumulator(), lo-1
+		}
+		for ; stepped < hi; stepped++ {
+			if j := stepped + 1; running || !p.excluded(i, j) {
+				if err := acc.step(args[j]); err != nil {
+					return err
+				}
+			}
+		}
+		v, err := acc.result()
+		if err != nil {
+			return err
+		}
+		set(i, v)
+	}
+	return nil
+}
+
+// frame returns the first and last row of the frame of row i, within the
+// partition. The frame is empty when lo > hi.
+func (p *partition) frame(i int) (lo, hi int) {
+	lo = max(p.bound(p.spec.Start, p.start, i, false), 0)
+	hi = min(p.bound(p.spec.End, p.end, i, true), len(p.rows)-1)
+	return lo, hi
+}
+
+// bound returns the first row of the frame of row i, or its last row when end
+// is set. The result may lie outside the partition, where the frame reaches
+// the edge of the partition or is empty.
+func (p *partition) bound(b FrameBound, offset Value, i int, end bool) int {
+	n := len(p.rows)
+	switch b.Kind {
+	case "UNBOUNDED PRECEDING":
+		return 0
+	case "UNBOUNDED FOLLOWING":
+		return n - 1
+	}
+	// sign is the direction of the bound from the current row.
+	sign := 0
+	switch b.Kind {
+	case "PRECEDING":
+		sign = -1
+	case "FOLLOWING":
+		sign = 1
+	}
+	switch p.spec.Units {
+	case "ROWS":
+		return i + sign*int(offset.Int)
+	case "GROUPS":
+		g := p.group[i] + sign*int(offset.Int)
+		switch {
+		case g < 0:
+			return -1
+		case g >= len(p.first):
+			return n
+		case end:
+			return p.last[g]
+		}
+		return p.first[g]
+	}
+	// RANGE: the rows whose ORDER BY value lies within offset of the current
+	// row's. A current value that is NULL or not a number only has its peers.
+	c := p.order[i]
+	if sign == 0 || len(c) == 0 || !c[0].isNumeric() {
+		if end {
+			return p.last[p.group[i]]
+		}
+		return p.first[p.group[i]]
+	}
+	key := p.keys[0]
+	op := "+"
+	if (sign < 0) != key.desc {
+		op = "-"
+	}
+	limit := arithmetic(op, c[0], offset)
+	if end {
+		return sort.Search(n, func(j int) bool { return key.compare(p.order[j][0], limit) > 0 }) - 1
+	}
+	return sort.Search(n, func(j int) bool { return key.compare(p.order[j][0], limit) >= 0 })
+}
+
+// excluded reports whether the EXCLUDE clause of the frame leaves row j out
+// of the frame of row i.
+func (p *partition) excluded(i, j int) bool {
+	switch p.spec.Exclude {
+	case "CURRENT ROW":
+		return i == j
+	case "GROUP":
+		return p.group[i] == p.group[j]
+	case "TIES":
+		return i != j && p.group[i] == p.group[j]
+	}
+	return false
+}
+
+// lastWindow returns the window of stmt computed first, which is the last one
+// its SELECT list and ORDER BY use. ok is false when they use none, and the
+// window is nil when one cannot be resolved.
+func lastWindow(stmt *SelectStmt) (spec *WindowSpec, ok bool) {
+	var calls []*FuncCall
+	for _, col := range stmt.Columns {
+		calls = windowCalls(col.Expr, calls)
+	}
+	for _, term := range stmt.OrderBy {
+		calls = windowCalls(term.Expr, calls)
+	}
+	w := &windowContext{stmt: stmt}
+	var specs []*WindowSpec
+	for _, call := range calls {
+		spec, err := w.resolve(call.Over, call.Window, len(stmt.Windows))
+		if err != nil {
+			return nil, true
+		}
+		if !slices.ContainsFunc(specs, func(s *WindowSpec) bool { return reflect.DeepEqual(s, spec) }) {
+			specs = append(specs, spec)
+		}
+	}
+	if len(specs) == 0 {
+		return nil, false
+	}
+	return specs[len(specs)-1], true
+}
+
+// windowCalls appends the window function calls of expr to calls, in the order
+// they are compiled. Subqueries have windows of their own.
+func windowCalls(expr Expr, calls []*FuncCall) []*FuncCall {
+	switch e := expr.(type) {
+	case *UnaryExpr:
+		return windowCalls(e.Operand, calls)
+	case *BinaryExpr:
+		return windowCalls(e.Right, windowCalls(e.Left, calls))
+	case *BetweenExpr:
+		return windowCalls(e.High, windowCalls(e.Low, windowCalls(e.Expr, calls)))
+	case *CollateExpr:
+		return windowCalls(e.Expr, calls)
+	case *CastExpr:
+		return windowCalls(e.Expr, calls)
+	case *InExpr:
+		calls = windowCalls(e.Expr, calls)
+		for _, item := range e.List {
+			calls = windowCalls(item, calls)
+		}
+	case *LikeExpr:
+		return windowCalls(e.Escape, windowCalls(e.Pattern, windowCalls(e.Expr, calls)))
+	case *CaseExpr:
+		calls = windowCalls(e.Operand, calls)
+		for _, when := range e.Whens {
+			calls = windowCalls(when.Then, windowCalls(when.When, calls))
+		}
+		return windowCalls(e.Else, calls)
+	case *FuncCall:
+		if e.Over != nil || e.Window != "" {
+			return append(calls, e)
+		}
+		for _, arg := range e.Args {
+			calls = windowCalls(arg, calls)
+		}
+	}
+	return calls
+}